@@ -5,13 +5,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"golisp/lib"
 	"golisp/parsing"
 	lisp "golisp/pkg"
 	"io"
 	"io/fs"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"sync"
 )
 
 func logo() {
@@ -39,11 +39,81 @@ func echo(out io.Writer) {
 	}
 }
 
+func report(out io.Writer, err error) {
+	fmt.Fprintf(out, "fatal error: %s\n", err)
+	var evalErr *lisp.EvalError
+	if errors.As(err, &evalErr) {
+		fmt.Fprint(out, evalErr.Backtrace())
+	}
+}
+
+// file name for source positions
+func sourceName(in io.Reader) string {
+	if in == os.Stdin {
+		return "<stdin>"
+	}
+	if f, ok := in.(interface{ Name() string }); ok {
+		return f.Name()
+	}
+	if f, ok := in.(fs.File); ok {
+		if info, err := f.Stat(); err == nil {
+			return info.Name()
+		}
+	}
+	return ""
+}
+
+// interrupter cancels the form being evaluated on Ctrl-C, leaving the REPL running
+type interrupter struct {
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	signals chan os.Signal
+}
+
+func newInterrupter() *interrupter {
+	intr := &interrupter{signals: make(chan os.Signal, 1)}
+	signal.Notify(intr.signals, os.Interrupt)
+	go func() {
+		for range intr.signals {
+			intr.mu.Lock()
+			if intr.cancel != nil {
+				intr.cancel()
+			}
+			intr.mu.Unlock()
+		}
+	}()
+	return intr
+}
+
+func (intr *interrupter) stop() {
+	if intr != nil {
+		signal.Stop(intr.signals)
+		close(intr.signals)
+	}
+}
+
+// context of the next form
+func (intr *interrupter) form(ctx context.Context) (context.Context, context.CancelFunc) {
+	if intr == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	intr.mu.Lock()
+	intr.cancel = cancel
+	intr.mu.Unlock()
+	return ctx, func() {
+		intr.mu.Lock()
+		intr.cancel = nil
+		intr.mu.Unlock()
+		cancel()
+	}
+}
+
 // main REPL function
-func Interpret(ctx context.Context, scope *lisp.LocalScope, in io.Reader, out io.Writer, catch bool) error {
+func Interpret(ctx context.Context, scope *lisp.LocalScope, in io.Reader, out io.Writer, catch bool) (err error) {
 	rd := bufio.NewReader(in)
 
-	src := parsing.NewFuncSource(rd.ReadRune)
+	src := parsing.NewFuncSource(rd.ReadRune).Named(sourceName(in))
 	defer src.Close()
 
 	echo(out)
@@ -55,10 +125,16 @@ func Interpret(ctx context.Context, scope *lisp.LocalScope, in io.Reader, out io
 		if e, ok := r.(error); ok && errors.Is(e, lisp.ErrEOF) {
 			src.Close()
 		} else if r != nil {
-			panic(r)
+			err = fmt.Errorf("%v", r)
 		}
 	}()
 
+	var intr *interrupter
+	if catch {
+		intr = newInterrupter()
+		defer intr.stop()
+	}
+
 	cmd := 0
 	for src.HasNext() {
 		select {
@@ -78,17 +154,35 @@ func Interpret(ctx context.Context, scope *lisp.LocalScope, in io.Reader, out io
 			}
 
 			expr := parser.ParseSExp()
-			res := expr.Exec(scope)
+			formCtx, done := intr.form(ctx)
+			res, evalErr := expr.EvalContext(formCtx, scope)
+			var shown string
+			if evalErr == nil && res != nil {
+				shown, evalErr = scope.Interpreter().Write(formCtx, res)
+			}
+			done()
+			if evalErr != nil {
+				if catch && out != nil {
+					report(out, evalErr)
+					echo(out)
+				} else if !catch {
+					err = evalErr
+				}
+				return
+			}
 			// cmd++
 			if out != nil {
 				//fmt.Fprintf(out, "$%d = %s:%v\n", cmd, reflect.TypeOf(res), res)
 				if res != nil {
 					cmd++
-					fmt.Fprintf(out, "$%d = %v\n", cmd, res)
+					fmt.Fprintf(out, "$%d = %s\n", cmd, shown)
 				}
 			}
 			echo(out)
 		}()
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -98,33 +192,16 @@ func Interpret(ctx context.Context, scope *lisp.LocalScope, in io.Reader, out io
 func main() {
 	logo()
 
-	err := fs.WalkDir(lib.StandardLibrary, ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() || filepath.Ext(path) != ".scm" {
-			return nil
-		}
-		if in, err := lib.StandardLibrary.Open(path); err != nil {
-			return err
-		} else {
-			fmt.Printf("loading %s...\n", path)
-			return Interpret(context.Background(), lisp.Global, in, nil, false)
-		}
-	})
-
-	if err != nil {
-		fmt.Println("error while loading the library: ", err)
-		os.Exit(1)
-	}
+	interp := lisp.New()
 
 	// _ = InterpretFile(lisp.Global, "hello.scm")
 
 	if len(os.Args) < 2 {
-		_ = Interpret(context.Background(), lisp.Global, os.Stdin, os.Stdout, true)
+		_ = Interpret(context.Background(), interp.Global(), os.Stdin, os.Stdout, true)
 	} else {
 		for _, fName := range os.Args[1:] {
-			if err := InterpretFile(lisp.Global, fName); err != nil {
+			if err := InterpretFile(interp.Global(), fName); err != nil {
+				report(os.Stderr, err)
 				os.Exit(1)
 			}
 		}
@@ -3,4 +3,5 @@
      b))
 
 (display "Hello world!")
+(newline)
 (println (sum 2000 25))
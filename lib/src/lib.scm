@@ -7,7 +7,7 @@
 ;(define (null? x) (eq? x '()))
 (define (not x) (if (eq? x #f) #t #f))
 (define (pair? p) (not (atom? p)))
-; (define (1- x) (- x 1)) (define (1+ x) (+ x 1))
+(define (1- x) (- x 1)) (define (1+ x) (+ x 1))
 (define (list . x) x)
 
 (define (_len l r)
@@ -86,10 +86,13 @@
 (defmacro defun (name args . body)
   (cons 'define (cons (cons name args) body)))
 
-; (let ((a 1) (b 2)) (+ a b))
-(defmacro let (bindings . exprs)
-  `((lambda ,(map-1 car bindings) ,@exprs)
-    ,@(map-1 cadr bindings)))
+; (let ((a 1) (b 2)) (+ a b)), named: (let loop ((i 0)) (if (< i 10) (loop (+ i 1)) i))
+(define-syntax let
+  (syntax-rules ()
+    ((_ ((name val) ...) body ...)
+      ((lambda (name ...) body ...) val ...))
+    ((_ tag ((name val) ...) body ...)
+      ((letrec ((tag (lambda (name ...) body ...))) tag) val ...))))
 
 ; (let* ((a 1) (b (+ 1 a))) b)
 (define-macro (let* bindings . exprs)
@@ -99,19 +102,21 @@
       (let* ,(cdr bindings) ,@exprs))))
 
 ; (or #f 1 2)
-(define-macro (or . exprs)
-  (if (null? exprs) #f
-    `(let ((h ,(car exprs)))
-      (if h h (or ,@(cdr exprs))))))
+(define-syntax or
+  (syntax-rules ()
+    ((_) #f)
+    ((_ e) e)
+    ((_ e1 e2 ...)
+      (let ((h e1))
+        (if h h (or e2 ...))))))
 
 ; (and 1 #t 5)
-(define-macro (and . exprs)
-  (if (null? exprs) #t
-    (let ((h (car exprs)))
-      (if (= 1 (length exprs)) h
-        `(if ,h
-          (and ,@(cdr exprs))
-          ,h)))))
+(define-syntax and
+  (syntax-rules ()
+    ((_) #t)
+    ((_ e) e)
+    ((_ e1 e2 ...)
+      (if e1 (and e2 ...) #f))))
 
 ; (some? zero? '(1 2 3 0))
 (define (some? predicate seq)
@@ -124,13 +129,19 @@
     (cons (apply f (map-1 car colls))
           (apply map f (map-1 cdr colls)))))
 
-; must have defaut clause
-; (cond ((= 1 2) 20) ((= 2 2) 30) (else 0))
-(define-macro (cond . ps)
-  (if (not (null? ps))
-    `(if ,(caar ps)
-      ,(cadar ps)
-      (cond ,@(cdr ps)))))
+; (cond ((= 1 2) 20) ((assq 'b '((a 1) (b 2))) => cadr) (else 0))
+(define-syntax cond
+  (syntax-rules (else =>)
+    ((_) (if #f #f))
+    ((_ (else e ...)) (begin e ...))
+    ((_ (test => f) clause ...)
+      (let ((t test))
+        (if t (f t) (cond clause ...))))
+    ((_ (test) clause ...)
+      (let ((t test))
+        (if t t (cond clause ...))))
+    ((_ (test e ...) clause ...)
+      (if test (begin e ...) (cond clause ...)))))
 (define else #t)
 
 ; (member 1 '((1) 2 3))
@@ -140,12 +151,18 @@
         (else (member v (cdr l)))))
 
 ; (case 10 ((1 2 3) 10) (else 20))
-(define-macro (case val . ps)   
-  (if (not (null? ps))
-    `(let ((lst (caar (quote ,ps))) (res ,(cadar ps)))
-      (cond ((eq? lst 'else) res)
-            ((member ,val lst) res)
-            (#t (case ,val ,@(cdr ps)))))))
+(define-syntax case
+  (syntax-rules (else =>)
+    ((_ (key ...) clause ...)
+      (let ((k (key ...)))
+        (case k clause ...)))
+    ((_ key) (if #f #f))
+    ((_ key (else => f)) (f key))
+    ((_ key (else e ...)) (begin e ...))
+    ((_ key ((datum ...) => f) clause ...)
+      (if (member key '(datum ...)) (f key) (case key clause ...)))
+    ((_ key ((datum ...) e ...) clause ...)
+      (if (member key '(datum ...)) (begin e ...) (case key clause ...)))))
 
 ; (bind-lists (a b c) '(1 2 3) (+ a b c))  
 (define-macro (bind-lists symbols vals . exprs)
@@ -186,8 +203,8 @@
 
 
 (define (make-promise p)
-  (let ([done? #f]
-        [res #f])
+  (let ((done? #f)
+        (res #f))
     (lambda ()
       (if done? res
         (begin
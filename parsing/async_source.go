@@ -11,13 +11,13 @@ type AsyncSource struct {
 
 	data   chan rune
 	closed bool
-	pos    int
+	pos    Position
 
 	queue *list.List
 }
 
 func NewAsyncSource() *AsyncSource {
-	return &AsyncSource{data: make(chan rune), queue: list.New()}
+	return &AsyncSource{data: make(chan rune), queue: list.New(), pos: start}
 }
 
 func (as *AsyncSource) Send(r rune) {
@@ -48,7 +48,7 @@ func (as *AsyncSource) Next() rune {
 	if as.queue.Len() > 0 {
 		res := as.queue.Front()
 		as.queue.Remove(res)
-		as.pos++
+		as.pos.advance(res.Value.(rune))
 		as.mu.Unlock()
 		return res.Value.(rune)
 	}
@@ -58,12 +58,20 @@ func (as *AsyncSource) Next() rune {
 	if !ok {
 		panic("async source ended")
 	}
-	as.pos++
+	as.mu.Lock()
+	as.pos.advance(r)
+	as.mu.Unlock()
 	return r
 }
 
+func (as *AsyncSource) Pos() Position {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.pos
+}
+
 func (as *AsyncSource) Error(msg string) error {
-	return fmt.Errorf("parse error: %d: %s", as.pos, msg)
+	return fmt.Errorf("parse error: %s: %s", as.Pos(), msg)
 }
 
 func (as *AsyncSource) Close() {
@@ -10,11 +10,11 @@ type RuneEmitter func() (rune, int, error)
 type FuncRuneSource struct {
 	emit RuneEmitter
 	done bool
-	pos  int
+	pos  Position
 }
 
 func NewFuncSource(fn RuneEmitter) *FuncRuneSource {
-	return &FuncRuneSource{emit: fn}
+	return &FuncRuneSource{emit: fn, pos: start}
 }
 
 func (fs *FuncRuneSource) HasNext() bool {
@@ -30,12 +30,20 @@ func (fs *FuncRuneSource) Next() rune {
 			fs.done = true
 		}
 	}
-	fs.pos++
+	fs.pos.advance(r)
 	return r
 }
 
+// sets the file name reported in positions
+func (fs *FuncRuneSource) Named(name string) *FuncRuneSource {
+	fs.pos.File = name
+	return fs
+}
+
+func (fs *FuncRuneSource) Pos() Position { return fs.pos }
+
 func (fs *FuncRuneSource) Error(msg string) error {
-	return fmt.Errorf("parse error: %d: %s", fs.pos, msg)
+	return fmt.Errorf("parse error: %s: %s", fs.Pos(), msg)
 }
 
 func (fs *FuncRuneSource) Close() {
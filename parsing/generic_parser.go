@@ -3,6 +3,7 @@ package parsing
 type BaseParser struct {
 	source CharSource
 	ch     rune // = -1
+	pos    Position
 
 	// async bool
 	// init  chan struct{}
@@ -43,6 +44,9 @@ func (bp *BaseParser) TakeNext() rune { // Take
 	// }
 
 	result := bp.ch
+	if ps, ok := bp.source.(Positioned); ok {
+		bp.pos = ps.Pos()
+	}
 	if bp.source.HasNext() {
 		bp.ch = bp.source.Next()
 	} else {
@@ -51,6 +55,11 @@ func (bp *BaseParser) TakeNext() rune { // Take
 	return result
 }
 
+// Position of the current (not yet taken) rune, zero if the source does not track it
+func (bp *BaseParser) Position() Position {
+	return bp.pos
+}
+
 func (bp *BaseParser) Test(expected rune) bool {
 	return bp.ch == expected
 }
@@ -0,0 +1,34 @@
+package parsing
+
+import "strconv"
+
+// Position of a rune in the source, lines and columns are counted from 1
+type Position struct {
+	File      string
+	Line, Col int
+}
+
+// sources which know where the next rune is
+type Positioned interface {
+	Pos() Position
+}
+
+var start = Position{Line: 1, Col: 1}
+
+func (p Position) String() string {
+	file := p.File
+	if file == "" {
+		file = "<input>"
+	}
+	return file + ":" + strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Col)
+}
+
+// advances the position past the rune
+func (p *Position) advance(r rune) {
+	if r == '\n' {
+		p.Line++
+		p.Col = 1
+	} else {
+		p.Col++
+	}
+}
@@ -8,11 +8,11 @@ import (
 type StringSource struct {
 	data   string
 	offset int
-	pos    int
+	pos    Position
 }
 
 func NewStringSource(s string) *StringSource {
-	return &StringSource{data: s}
+	return &StringSource{data: s, pos: start}
 }
 
 func (ss *StringSource) HasNext() bool {
@@ -21,13 +21,21 @@ func (ss *StringSource) HasNext() bool {
 
 func (ss *StringSource) Next() rune {
 	r, sz := utf8.DecodeRuneInString(ss.data[ss.offset:])
-	ss.pos++
+	ss.pos.advance(r)
 	ss.offset += sz
 	return r
 }
 
+// sets the file name reported in positions
+func (ss *StringSource) Named(name string) *StringSource {
+	ss.pos.File = name
+	return ss
+}
+
+func (ss *StringSource) Pos() Position { return ss.pos }
+
 func (ss *StringSource) Error(msg string) error {
-	return fmt.Errorf("parse error: %d: %s", ss.pos, msg)
+	return fmt.Errorf("parse error: %s: %s", ss.Pos(), msg)
 }
 
 func (ss *StringSource) Close() {}
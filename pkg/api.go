@@ -0,0 +1,94 @@
+package lisp
+
+import (
+	"bufio"
+	"context"
+	"golisp/parsing"
+	"io"
+	"os"
+)
+
+// The embedding API: every failure is returned as an error, wrapped in
+// *EvalError when it happened during the evaluation. The cause can be checked
+// with errors.As against SyntaxError, UnboundError, ArityError, TypeError,
+// *ErrorObject (created by `error`), Raised (any other raised object) or
+// InterruptError when ctx is done in the middle of the evaluation,
+// LimitError when it exceeds the Limits of the interpreter.
+
+// EvalString evaluates all the expressions of src, returns the value of the last one
+func (it *Interpreter) EvalString(ctx context.Context, src string) (any, error) {
+	return it.evalSource(ctx, parsing.NewStringSource(src), it.newQuota())
+}
+
+func (it *Interpreter) EvalReader(ctx context.Context, r io.Reader) (any, error) {
+	src := parsing.NewFuncSource(bufio.NewReader(r).ReadRune)
+	if f, ok := r.(interface{ Name() string }); ok {
+		src.Named(f.Name())
+	}
+	return it.evalSource(ctx, src, it.newQuota())
+}
+
+func (it *Interpreter) LoadFile(ctx context.Context, path string) (any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return it.EvalReader(ctx, f)
+}
+
+// Call applies the procedure to the arguments, which are Lisp values
+func (it *Interpreter) Call(ctx context.Context, fn *Func, args ...any) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var list *ConsCell
+	if len(args) > 0 {
+		list = ConsList(args...)
+	}
+	return runThread(ctx, it.global, it.newQuota(), Frame{Name: "call"}, func(scope *LocalScope) any {
+		return fn.Call(scope, list)
+	})
+}
+
+// Write is the written form of the value as by write, the printers of the record types
+// run in an evaluation stopped when ctx is done, with the limits of the interpreter
+func (it *Interpreter) Write(ctx context.Context, v any) (string, error) {
+	res, err := runThread(ctx, it.global, it.newQuota(), Frame{Name: "write"}, func(scope *LocalScope) any {
+		return (&printer{ls: scope}).print(v)
+	})
+	s, _ := res.(string)
+	return s, err
+}
+
+// all the forms share the quota, nil for no limits
+func (it *Interpreter) evalSource(ctx context.Context, cs parsing.CharSource, q *quota) (res any, err error) {
+	parser := NewSExpParser(cs)
+	defer func() {
+		if r := recover(); r != nil { // the reader fails outside of the evaluation
+			err = errorOf(r)
+			if _, ok := err.(SyntaxError); !ok {
+				err = SyntaxError{err.Error()}
+			}
+		}
+	}()
+	for parser.More() {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if res, err = parser.ParseSExp().eval(ctx, it.global, q); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// the same on the Default interpreter
+
+func EvalString(ctx context.Context, src string) (any, error)  { return Default.EvalString(ctx, src) }
+func EvalReader(ctx context.Context, r io.Reader) (any, error) { return Default.EvalReader(ctx, r) }
+func LoadFile(ctx context.Context, path string) (any, error)   { return Default.LoadFile(ctx, path) }
+
+func Call(ctx context.Context, fn *Func, args ...any) (any, error) {
+	return Default.Call(ctx, fn, args...)
+}
@@ -0,0 +1,145 @@
+package lisp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EvalString(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+
+	res, err := interp.EvalString(ctx, `(define (sq x) (* x x)) (sq 4)`)
+	assert.NoError(t, err)
+	assert.Equal(t, Integer(16), res)
+
+	for _, test := range []struct {
+		code  string
+		check func(error) bool
+	}{
+		{`(sq`, func(err error) bool { return errors.As(err, new(SyntaxError)) }},
+		{`(+ 1 )) (`, func(err error) bool { return errors.As(err, new(SyntaxError)) }},
+		{`(sq no-such)`, func(err error) bool {
+			var u UnboundError
+			return errors.As(err, &u) && u.symbol == "no-such"
+		}},
+		{`(sq 1 2)`, func(err error) bool { return errors.Is(err, TooManyArguments) }},
+		{`(sq)`, func(err error) bool { return errors.Is(err, TooFewArguments) }},
+		{`(car 1)`, func(err error) bool { return errors.As(err, new(TypeError)) }},
+		{`(1 2)`, func(err error) bool { return errors.As(err, new(TypeError)) }},
+		{`(error "bad" 1)`, func(err error) bool {
+			var e *ErrorObject
+			return errors.As(err, &e) && e.Error() == "bad: 1"
+		}},
+		{`(raise 'oops)`, func(err error) bool {
+			var r Raised
+			return errors.As(err, &r) && r.Payload == Atomic("oops")
+		}},
+	} {
+		_, err := interp.EvalString(ctx, test.code)
+		assert.Error(t, err, test.code)
+		assert.True(t, test.check(err), "%s: %v", test.code, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = interp.EvalString(cancelled, `1`)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func Test_LoadFile_Call(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "lib.scm")
+	assert.NoError(t, os.WriteFile(path, []byte("(define (add a b)\n  (+ a b))\n(define (fail x)\n  (car x))\n"), 0o644))
+
+	_, err := interp.LoadFile(ctx, path)
+	assert.NoError(t, err)
+
+	add, err := interp.EvalString(ctx, `add`)
+	assert.NoError(t, err)
+	res, err := interp.Call(ctx, add.(*Func), Integer(1), Integer(2))
+	assert.NoError(t, err)
+	assert.Equal(t, Integer(3), res)
+
+	fail, _ := interp.EvalString(ctx, `fail`)
+	_, err = interp.Call(ctx, fail.(*Func), Integer(1))
+	var evalErr *EvalError
+	assert.ErrorAs(t, err, &evalErr)
+	assert.Equal(t, "at fail ("+path+":4:3)", evalErr.Stack[0].String())
+
+	_, err = interp.LoadFile(ctx, filepath.Join(t.TempDir(), "missing.scm"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_EvalString_timeout(t *testing.T) {
+	interp := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := interp.EvalString(ctx, `(define (spin) (spin)) (spin)`)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorAs(t, err, new(InterruptError))
+
+	res, err := interp.EvalString(ctx, `(guard (e ((interrupted-error? e) 'stopped)) (spin))`)
+	assert.ErrorIs(t, err, context.DeadlineExceeded) // ctx is done before the next form starts
+	assert.Nil(t, res)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res, err = interp.EvalString(ctx, `(guard (e ((interrupted-error? e) 'stopped)) (spin))`)
+	assert.NoError(t, err)
+	assert.Equal(t, Atomic("stopped"), res)
+}
+
+func Test_interrupted_handlers(t *testing.T) {
+	interp := New()
+	_, err := interp.EvalString(context.Background(), `(define (spin) (spin))`)
+	assert.NoError(t, err)
+
+	for _, code := range []string{
+		`(guard (e (#t (spin))) (spin))`,
+		`(with-exception-handler (lambda (e) (spin)) spin)`,
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		done := make(chan error, 1)
+		go func() {
+			_, err := interp.EvalString(ctx, code)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			assert.ErrorAs(t, err, new(InterruptError), code)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s is not interrupted", code)
+		}
+		cancel()
+	}
+
+	var out bytes.Buffer
+	interp.SetStdout(&out)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	RegisterGo(interp.Global(), "cancel", func() { cancel() })
+	_, err = interp.EvalString(ctx, `
+		(dynamic-wind (lambda () #t) (lambda () (cancel) (spin)) (lambda () (write-string "cleanup ran")))`)
+	assert.ErrorAs(t, err, new(InterruptError))
+	assert.Equal(t, "cleanup ran", out.String())
+
+	limited := New(WithLimits(Limits{MaxSteps: 1000}))
+	_, err = limited.EvalString(context.Background(), `
+		(define cleaned #f)
+		(define (spin) (spin))
+		(dynamic-wind (lambda () #t) spin (lambda () (set! cleaned (list 'cleaned))))`)
+	assert.ErrorAs(t, err, new(LimitError))
+	res, err := limited.EvalString(context.Background(), `cleaned`)
+	assert.NoError(t, err)
+	assert.Equal(t, "(cleaned)", toStr(res))
+}
@@ -2,14 +2,15 @@ package lisp
 
 import (
 	"fmt"
-	"strconv"
 )
 
 type (
 	NilType   struct{}
 	Boolean   bool    // true, false
-	Number    float64 // 123
+	Number    float64 // 1.5, inexact
+	Integer   int64   // 123, exact
 	RawString string  // "..."
+	Char      rune    // #\a
 	Keyword   string  // :kw
 	Atomic    string  // atom
 
@@ -49,16 +50,22 @@ func (b Boolean) String() string {
 	}
 	return "#f"
 }
-func (n Number) String() string    { return strconv.FormatFloat(float64(n), 'f', -1, 64) }
-func (r RawString) String() string { return "\"" + string(r) + "\"" }
+func (r RawString) String() string { return quoteString(string(r), '"') }
 func (s _Symbol) String() string   { return "'" + string(s) }
 func (k Keyword) String() string   { return ":" + string(k) }
-func (a Atomic) String() string    { return string(a) }
+func (a Atomic) String() string {
+	if plainSymbol(string(a)) {
+		return string(a)
+	}
+	return quoteString(string(a), '|')
+}
 
 func (NilType) Bool() bool     { return false }
 func (b Boolean) Bool() bool   { return bool(b) }
 func (n Number) Bool() bool    { return n != 0 }
+func (i Integer) Bool() bool   { return i != 0 }
 func (r RawString) Bool() bool { return r != "" }
+func (c Char) Bool() bool      { return true }
 func (a Atomic) Bool() bool    { return true }
 func (c *ConsCell) Bool() bool { return c != nil }
 func (f Func) Bool() bool      { return true }
@@ -66,7 +73,9 @@ func (f Func) Bool() bool      { return true }
 func (NilType) Exec(*LocalScope) any     { return Nil }
 func (b Boolean) Exec(*LocalScope) any   { return b }
 func (n Number) Exec(*LocalScope) any    { return n }
+func (i Integer) Exec(*LocalScope) any   { return i }
 func (r RawString) Exec(*LocalScope) any { return r }
+func (c Char) Exec(*LocalScope) any      { return c }
 func (s _Symbol) Exec(*LocalScope) any   { return s }
 func (k Keyword) Exec(*LocalScope) any   { return k }
 func (f Func) Exec(*LocalScope) any      { return f }
@@ -74,18 +83,13 @@ func (f Func) Exec(*LocalScope) any      { return f }
 func (a Atomic) Exec(ctx *LocalScope) any {
 	if val, ok := ctx.Get(a); ok {
 		return val
+	} else if al, ok := aliasOf(ctx, a); ok { // free identifier inserted by a macro
+		return al.name.Exec(al.env)
 	} else {
 		panic(UnboundError{a})
 	}
 }
 
-var symCnt = 0
-
-func GenSym(_ *LocalScope, prefix string) Atomic {
-	if prefix == "" {
-		prefix = "_"
-	}
-	res := Atomic(prefix + strconv.Itoa(symCnt))
-	symCnt++
-	return res
+func GenSym(ctx *LocalScope, prefix string) Atomic {
+	return ctx.Interpreter().GenSym(prefix)
 }
@@ -0,0 +1,204 @@
+package lisp
+
+import (
+	"context"
+	"golisp/parsing"
+	"slices"
+	"strings"
+)
+
+// Frame is an entry of the Lisp call stack: the procedure and the form it evaluates
+type Frame struct {
+	Name string
+	Pos  *parsing.Position // nil if unknown
+}
+
+func (f Frame) String() string {
+	name := f.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	if f.Pos == nil {
+		return "at " + name
+	}
+	return "at " + name + " (" + f.Pos.String() + ")"
+}
+
+// thread is the state of one evaluation; a panic leaves the stack as it was
+// at the moment of the failure, everything recovering from it truncates the stack back
+type thread struct {
+	stack   []Frame
+	nesting int // evaluation loops on the Go stack
+	quota   *quota
+	ctx     context.Context
+	done    <-chan struct{}
+	entered int // frames entered so far
+	quiet   int // while no more frames are entered, the calls are not interrupted nor counted
+}
+
+// a state of the thread to rewind to after recovering from a panic
+type mark struct{ frames, nesting int }
+
+// called at every procedure call, so loops are interrupted too
+func (th *thread) checkpoint() {
+	if th == nil || th.entered <= th.quiet {
+		return
+	}
+	th.quota.step()
+	if th.done == nil {
+		return
+	}
+	select {
+	case <-th.done:
+		panic(InterruptError{th.ctx.Err()})
+	default:
+	}
+}
+
+func (th *thread) depth() int {
+	if th == nil {
+		return 0
+	}
+	return len(th.stack)
+}
+
+func (th *thread) unwind(depth int) {
+	if th != nil && len(th.stack) > depth {
+		th.stack = th.stack[:depth]
+	}
+}
+
+func (th *thread) mark() mark {
+	if th == nil {
+		return mark{}
+	}
+	return mark{len(th.stack), th.nesting}
+}
+
+func (th *thread) rewind(m mark) {
+	if th != nil {
+		th.unwind(m.frames)
+		th.nesting = m.nesting
+	}
+}
+
+// starts an evaluation loop nested in the current one
+func (th *thread) begin() mark {
+	m := th.mark()
+	if th != nil {
+		th.nesting++
+		th.quota.nest(th.nesting)
+	}
+	return m
+}
+
+// pushes the frame, replacing the one the tail call was made from
+func (th *thread) enter(base int, f Frame) {
+	th.unwind(base)
+	th.stack = append(th.stack, f)
+	th.entered++
+}
+
+// the innermost frame is evaluating the form at pos now
+func (th *thread) at(pos *parsing.Position) {
+	if th != nil && pos != nil && len(th.stack) > 0 {
+		th.stack[len(th.stack)-1].Pos = pos
+	}
+}
+
+// runs the handler of the condition; the handler of an interruption is not interrupted
+// in its own frames, but the procedures it calls are, like the code after it
+func (th *thread) handling(cond any, frames int, handler func()) {
+	if _, ok := cond.(InterruptError); ok {
+		th.sheltered(frames, handler)
+	} else {
+		handler()
+	}
+}
+
+// runs fn with its calls not interrupted and not counted until it enters more frames
+// (1 for a procedure, 0 for inline code): the calls of the procedures fn calls are
+func (th *thread) sheltered(frames int, fn func()) {
+	if th == nil {
+		fn()
+		return
+	}
+	saved := th.quiet
+	th.quiet = th.entered + frames
+	defer func() { th.quiet = saved }()
+	fn()
+}
+
+func (th *thread) snapshot() []Frame {
+	if th == nil {
+		return nil
+	}
+	return slices.Clone(th.stack)
+}
+
+func (th *thread) restore(stack []Frame) {
+	if th != nil {
+		th.stack = stack
+	}
+}
+
+// innermost first
+func (th *thread) backtrace() []Frame {
+	res := make([]Frame, len(th.stack))
+	for i, f := range th.stack {
+		res[len(res)-1-i] = f
+	}
+	return res
+}
+
+// EvalError is an error not caught by the Lisp code with the call stack at the point it happened
+type EvalError struct {
+	Err   error
+	Stack []Frame // innermost first
+}
+
+func (e *EvalError) Error() string { return e.Err.Error() }
+func (e *EvalError) Unwrap() error { return e.Err }
+
+func (e *EvalError) Backtrace() string {
+	var sb strings.Builder
+	for _, f := range e.Stack {
+		sb.WriteString("  " + f.String() + "\n")
+	}
+	return sb.String()
+}
+
+// Eval executes the expression with the call stack tracked,
+// an uncaught failure is returned as *EvalError instead of a panic
+func (e Expr) Eval(scope *LocalScope) (res any, err error) {
+	return e.EvalContext(context.Background(), scope)
+}
+
+// EvalContext is Eval stopped with InterruptError when ctx is done
+func (e Expr) EvalContext(ctx context.Context, scope *LocalScope) (res any, err error) {
+	return e.eval(ctx, scope, scope.Interpreter().newQuota())
+}
+
+func (e Expr) eval(ctx context.Context, scope *LocalScope, q *quota) (res any, err error) {
+	return runThread(ctx, scope, q, Frame{Name: "toplevel", Pos: e.Pos()}, e.Exec)
+}
+
+// runs fn in a new evaluation thread starting with the frame, q may be shared by several threads run one by one
+func runThread(ctx context.Context, scope *LocalScope, q *quota, top Frame, fn func(*LocalScope) any) (res any, err error) {
+	th := &thread{quota: q, ctx: ctx, done: ctx.Done()}
+	th.enter(0, top)
+	defer func() {
+		if r := recover(); r != nil {
+			err = &EvalError{Err: errorOf(r), Stack: th.backtrace()}
+		}
+	}()
+	return fn(scope.withDynamic(scope.dyn.withThread(th))), nil
+}
+
+// Pos is where the expression was read, nil if unknown
+func (e Expr) Pos() *parsing.Position {
+	if e.pos == nil && e.isSExpr {
+		return e.sexp.Pos()
+	}
+	return e.pos
+}
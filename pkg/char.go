@@ -0,0 +1,154 @@
+package lisp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the names of #\space and the like, both ways
+var charNames = map[string]Char{
+	"alarm": 7, "backspace": 8, "delete": 0x7f, "escape": 0x1b, "newline": '\n',
+	"null": 0, "return": '\r', "space": ' ', "tab": '\t',
+}
+
+var namesOfChars = func() map[Char]string {
+	res := make(map[Char]string, len(charNames))
+	for name, c := range charNames {
+		res[c] = name
+	}
+	return res
+}()
+
+func (c Char) String() string {
+	if name, ok := namesOfChars[c]; ok {
+		return `#\` + name
+	} else if !unicode.IsPrint(rune(c)) {
+		return `#\x` + strconv.FormatInt(int64(c), 16)
+	}
+	return `#\` + string(c)
+}
+
+// the character of the name after #\: a, space, x41
+func charOfName(name string) (Char, bool) {
+	if r, size := utf8.DecodeRuneInString(name); size == len(name) && r != utf8.RuneError {
+		return Char(r), true
+	} else if c, ok := charNames[strings.ToLower(name)]; ok {
+		return c, true
+	} else if hex, ok := strings.CutPrefix(name, "x"); ok {
+		if code, err := strconv.ParseUint(hex, 16, 32); err == nil && utf8.ValidRune(rune(code)) {
+			return Char(code), true
+		}
+	}
+	return 0, false
+}
+
+func foldCase(r rune) rune { return unicode.ToLower(unicode.ToUpper(r)) }
+
+func charOf(name string, v any) Char {
+	c, ok := v.(Char)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("%s: <%s> of type <%s> is not a character", name, toStr(v), TypeOf(v))})
+	}
+	return c
+}
+
+// the character at the rune index k
+func stringRef(s RawString, k any) Char {
+	i := indexOf("string-ref", k, utf8.RuneCountInString(string(s))-1)
+	for _, r := range s {
+		if i == 0 {
+			return Char(r)
+		}
+		i--
+	}
+	panic(ExecError{"string-ref: index out of range"}) // unreachable
+}
+
+func registerChars(global *LocalScope) {
+	builtin := func(name Atomic, params any, fn func(ls *LocalScope, args []any) any) {
+		global.Set(name, builtinFunc(params, fn))
+	}
+	// (char=? c1 c2 c3 ...) of all the adjacent characters, -ci ones compare the folded case
+	comparison := func(name string, fold bool, holds func(a, b Char) bool) {
+		builtin(Atomic(name), Cons(Atomic("char1"), Atomic("chars")), func(ls *LocalScope, args []any) any {
+			checkArity(args, 1, math.MaxInt)
+			res := true
+			for i := range args {
+				c := charOf(name, args[i])
+				if i > 0 {
+					prev := charOf(name, args[i-1])
+					if fold {
+						prev, c = Char(foldCase(rune(prev))), Char(foldCase(rune(c)))
+					}
+					res = res && holds(prev, c)
+				}
+			}
+			return Boolean(res)
+		})
+	}
+	for prefix, ci := range map[string]bool{"char": false, "char-ci": true} {
+		comparison(prefix+"=?", ci, func(a, b Char) bool { return a == b })
+		comparison(prefix+"<?", ci, func(a, b Char) bool { return a < b })
+		comparison(prefix+">?", ci, func(a, b Char) bool { return a > b })
+		comparison(prefix+"<=?", ci, func(a, b Char) bool { return a <= b })
+		comparison(prefix+">=?", ci, func(a, b Char) bool { return a >= b })
+	}
+
+	predicate := func(name string, pred func(rune) bool) {
+		builtin(Atomic(name), ConsList[Atomic]("char"), func(ls *LocalScope, args []any) any {
+			return Boolean(pred(rune(charOf(name, checkArity(args, 1, 1)[0]))))
+		})
+	}
+	predicate("char-alphabetic?", unicode.IsLetter)
+	predicate("char-numeric?", unicode.IsDigit)
+	predicate("char-whitespace?", unicode.IsSpace)
+	predicate("char-upper-case?", unicode.IsUpper)
+	predicate("char-lower-case?", unicode.IsLower)
+
+	conversion := func(name string, conv func(rune) rune) {
+		builtin(Atomic(name), ConsList[Atomic]("char"), func(ls *LocalScope, args []any) any {
+			return Char(conv(rune(charOf(name, checkArity(args, 1, 1)[0]))))
+		})
+	}
+	conversion("char-upcase", unicode.ToUpper)
+	conversion("char-downcase", unicode.ToLower)
+	conversion("char-foldcase", foldCase)
+
+	builtin("char?", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		_, ok := checkArity(args, 1, 1)[0].(Char)
+		return Boolean(ok)
+	})
+	builtin("char->integer", ConsList[Atomic]("char"), func(ls *LocalScope, args []any) any {
+		return Integer(charOf("char->integer", checkArity(args, 1, 1)[0]))
+	})
+	builtin("integer->char", ConsList[Atomic]("n"), func(ls *LocalScope, args []any) any {
+		n, ok := checkArity(args, 1, 1)[0].(Integer)
+		if !ok || n < 0 || n > unicode.MaxRune || !utf8.ValidRune(rune(n)) {
+			panic(TypeError{fmt.Sprintf("integer->char: <%s> is not a Unicode scalar value", toStr(args[0]))})
+		}
+		return Char(n)
+	})
+	// (digit-value #\7) is 7, #f for the characters that are not decimal digits
+	builtin("digit-value", ConsList[Atomic]("char"), func(ls *LocalScope, args []any) any {
+		c := rune(charOf("digit-value", checkArity(args, 1, 1)[0]))
+		if !unicode.IsDigit(c) {
+			return False
+		}
+		zero := c // the digits of every script are contiguous, some scripts have several sets of ten
+		for unicode.IsDigit(zero - 1) {
+			zero--
+		}
+		return Integer((c - zero) % 10)
+	})
+	builtin("string-ref", ConsList[Atomic]("string", "k"), func(ls *LocalScope, args []any) any {
+		s, ok := checkArity(args, 2, 2)[0].(RawString)
+		if !ok {
+			panic(TypeError{fmt.Sprintf("string-ref: <%s> is not a string", toStr(args[0]))})
+		}
+		return stringRef(s, args[1])
+	})
+}
@@ -0,0 +1,44 @@
+package lisp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_chars(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+
+	for _, test := range []struct{ code, expected string }{
+		{`(list #\a #\A #\( #\space #\newline #\tab #\x41 #\x #\λ #\x7)`, `(#\a #\A #\( #\space #\newline #\tab #\A #\x #\λ #\alarm)`},
+		{`(list #\x0 #\x80)`, `(#\null #\x80)`},
+		{`(list (char? #\a) (char? "a") (char->integer #\A) (integer->char 955))`, `(#t #f 65 #\λ)`},
+		{`(list (char=? #\a #\a #\a) (char<? #\a #\b #\c) (char<? #\a #\c #\b) (char>=? #\b #\a))`, `(#t #t #f #t)`},
+		{`(list (char-ci=? #\a #\A) (char-ci<? #\a #\B) (char=? #\a #\A))`, `(#t #t #f)`},
+		{`(list (char-upcase #\ä) (char-downcase #\Σ) (char-foldcase #\A))`, `(#\Ä #\σ #\a)`},
+		{`(list (char-alphabetic? #\я) (char-numeric? #\7) (char-whitespace? #\tab) (char-alphabetic? #\1))`, `(#t #t #t #f)`},
+		{`(list (char-upper-case? #\A) (char-lower-case? #\A))`, `(#t #f)`},
+		{`(list (digit-value #\7) (digit-value #\x664) (digit-value #\a))`, `(7 4 #f)`},
+		{`(list (string-ref "añb" 1) (string-ref "añb" 2) (char "🙂!" 1))`, `(#\ñ #\b #\!)`},
+		{`(eqv? #\a (string-ref "abc" 0))`, `#t`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	_, err := interp.EvalString(ctx, `(string-ref "añb" 3)`)
+	assert.ErrorAs(t, err, new(ExecError))
+	_, err = interp.EvalString(ctx, `(char->integer "a")`)
+	assert.ErrorAs(t, err, new(TypeError))
+	_, err = interp.EvalString(ctx, `(integer->char 55296)`) // a surrogate
+	assert.ErrorAs(t, err, new(TypeError))
+	_, err = interp.EvalString(ctx, `#\bogus`)
+	assert.ErrorAs(t, err, new(SyntaxError))
+
+	s, err := ToGo[string](Char('λ'))
+	assert.NoError(t, err)
+	assert.Equal(t, "λ", s)
+}
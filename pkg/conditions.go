@@ -0,0 +1,183 @@
+package lisp
+
+func Raise(obj any) {
+	panic(Raised{Payload: obj})
+}
+
+// the innermost handler is called in the dynamic environment of the raise,
+// but with itself uninstalled; guard just gets the object like from raise
+func RaiseContinuable(ctx *LocalScope, obj any) any {
+	frame := ctx.dyn.currentHandlers()
+	if frame == nil || frame.handler == nil {
+		panic(Raised{Payload: obj, Continuable: true})
+	}
+	return frame.handler.Call(ctx.withDynamic(ctx.dyn.withHandlers(frame.next)), Cons(obj, nil))
+}
+
+// continuation jumps are not exceptions and pass through handlers
+func recoverCondition(r any) any {
+	if _, ok := r.(*continuationJump); ok {
+		panic(r)
+	}
+	return ConditionOf(r)
+}
+
+// non-continuable exceptions are caught after the stack is unwound to here,
+// the handler runs in the dynamic environment of with-exception-handler itself
+func WithExceptionHandler(ctx *LocalScope, handler, thunk *Func) any {
+	th := ctx.dyn.currentThread()
+	m := th.mark()
+	defer func() {
+		if r := recover(); r != nil {
+			th.rewind(m)
+			cond := recoverCondition(r)
+			th.handling(cond, 1, func() { handler.Call(ctx, Cons(cond, nil)) })
+			panic(HandlerReturned)
+		}
+	}()
+	return thunk.Call(ctx.withHandler(handler), nil)
+}
+
+// (guard (var clause ...) body ...), clauses are as in cond;
+// if none of them matches, the object is raised again
+func Guard(ctx *LocalScope, spec Pair, body Pair) (res any) {
+	name, ok := spec.Car().(Atomic)
+	if !ok {
+		panic(SyntaxError{"guard: variable expected"})
+	}
+	th := ctx.dyn.currentThread()
+	m := th.mark()
+	defer func() {
+		if r := recover(); r != nil {
+			stack := th.snapshot()
+			th.rewind(m)
+			cond := recoverCondition(r)
+			handlerCtx := ctx.Sub()
+			handlerCtx.Set(name, cond)
+			var matched bool
+			th.handling(cond, 0, func() { res, matched = condClauses(handlerCtx, PairOf(spec.Cdr())) })
+			if !matched {
+				th.restore(stack)
+				panic(r)
+			}
+		}
+	}()
+	bodyCtx := ctx.withHandler(nil)
+	IterateCons(body, func(e any) bool {
+		res = ExprOfAny(e).Exec(bodyCtx)
+		return true
+	})
+	return res
+}
+
+// (test expr ...), (test => proc), (else expr ...)
+func condClauses(ctx *LocalScope, clauses Pair) (res any, matched bool) {
+	for ; !IsEmptyList(clauses); clauses = PairOf(clauses.Cdr()) {
+		clause, ok := clauses.Car().(Pair)
+		if !ok || IsNil(clause) {
+			panic(SyntaxError{"clause expected"})
+		}
+		var test any = True
+		if clause.Car() != Atomic("else") {
+			test = ExprOfAny(clause.Car()).Exec(ctx)
+		}
+		if !IsTrue(test) {
+			continue
+		}
+		body := PairOf(clause.Cdr())
+		if IsEmptyList(body) {
+			return test, true
+		}
+		if body.Car() == Atomic("=>") {
+			proc := ExprOfAny(PairOf(body.Cdr()).Car()).Exec(ctx).(*Func)
+			return proc.Call(ctx, Cons(test, nil)), true
+		}
+		IterateCons(body, func(e any) bool {
+			res = ExprOfAny(e).Exec(ctx)
+			return true
+		})
+		return res, true
+	}
+	return nil, false
+}
+
+func conditionPredicate[T any](global *LocalScope, name Atomic) {
+	global.Set(name, &Func{
+		args: ExprOfAny(ConsList[Atomic]("obj")),
+		fn: func(ls *LocalScope, p Pair) any {
+			_, ok := p.Car().(T)
+			return Boolean(ok)
+		},
+	})
+}
+
+func registerConditions(global *LocalScope) {
+	global.Set("error", &Func{ // (error "message" irritant ...)
+		args: ExprOfAny(ConsListDotted[Atomic]("message", "irritants")),
+		fn: func(ls *LocalScope, p Pair) any {
+			message, ok := p.Car().(RawString)
+			if !ok {
+				message = RawString(toStr(p.Car()))
+			}
+			panic(&ErrorObject{message: string(message), irritants: NullSafeCast[*ConsCell](p.Cdr())})
+		},
+	})
+
+	global.Set("raise", &Func{
+		args: ExprOfAny(ConsList[Atomic]("obj")),
+		fn: func(ls *LocalScope, p Pair) any {
+			Raise(p.Car())
+			return nil
+		},
+	})
+
+	global.Set("raise-continuable", &Func{
+		args: ExprOfAny(ConsList[Atomic]("obj")),
+		fn: func(ls *LocalScope, p Pair) any {
+			return RaiseContinuable(ls, p.Car())
+		},
+	})
+
+	global.Set("with-exception-handler", &Func{
+		args: ExprOfAny(ConsList[Atomic]("handler", "thunk")),
+		fn: func(ls *LocalScope, p Pair) any {
+			handler, thunk := p.Car().(*Func), p.Cdr().(Pair).Car().(*Func)
+			return WithExceptionHandler(ls, handler, thunk)
+		},
+	})
+
+	global.Set("guard", &Func{
+		macro: true,
+		args:  ExprOfAny(ConsListDotted[Atomic]("spec", "body")),
+		fn: func(ls *LocalScope, p Pair) any {
+			spec, ok := p.Car().(Pair)
+			if !ok || IsNil(spec) {
+				panic(SyntaxError{"guard: wrong syntax"})
+			}
+			return Guard(ls, spec, PairOf(p.Cdr()))
+		},
+	})
+
+	global.Set("error-object-message", &Func{
+		args: ExprOfAny(ConsList[Atomic]("err")),
+		fn: func(ls *LocalScope, p Pair) any {
+			return RawString(p.Car().(Condition).Message())
+		},
+	})
+
+	global.Set("error-object-irritants", &Func{
+		args: ExprOfAny(ConsList[Atomic]("err")),
+		fn: func(ls *LocalScope, p Pair) any {
+			return p.Car().(Condition).Irritants()
+		},
+	})
+
+	conditionPredicate[Condition](global, "error-object?")
+	conditionPredicate[UnboundError](global, "unbound-variable-error?")
+	conditionPredicate[SyntaxError](global, "syntax-error?")
+	conditionPredicate[SyntaxError](global, "read-error?")
+	conditionPredicate[TypeError](global, "type-error?")
+	conditionPredicate[ArityError](global, "arity-error?")
+	conditionPredicate[InterruptError](global, "interrupted-error?")
+	conditionPredicate[LimitError](global, "limit-error?")
+}
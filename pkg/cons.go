@@ -2,8 +2,9 @@ package lisp
 
 import (
 	"fmt"
-	"golisp/functional"
+	"golisp/parsing"
 	"strings"
+	"sync/atomic"
 )
 
 // lambda -> let, do
@@ -18,6 +19,14 @@ func (e Expr) String() string {
 	}
 }
 
+// the list or the atom of the expression
+func (e Expr) value() any {
+	if e.isSExpr {
+		return e.sexp
+	}
+	return e.atom
+}
+
 func (e Expr) DebugString() string {
 	if e.isSExpr {
 		return e.sexp.DebugString()
@@ -33,6 +42,8 @@ type Pair interface {
 
 type ConsCell struct {
 	car, cdr any
+	pos      *parsing.Position         // where the list was read, nil for constructed ones
+	exp      atomic.Pointer[expansion] // of the macro call
 }
 
 func IsCons(v any) bool {
@@ -46,10 +57,25 @@ func IsEmptyList(v any) bool {
 	return v == nil || v == EmptyList
 }
 
-func (c ConsCell) Car() any       { return c.car }
-func (c ConsCell) Cdr() any       { return c.cdr }
+func (c *ConsCell) Car() any      { return c.car }
+func (c *ConsCell) Cdr() any      { return c.cdr }
 func Cons(car, cdr any) *ConsCell { return &ConsCell{car: car, cdr: cdr} }
 
+// Pos is the source position of a parsed list
+func (c *ConsCell) Pos() *parsing.Position {
+	if c == nil {
+		return nil
+	}
+	return c.pos
+}
+
+func (c *ConsCell) at(pos *parsing.Position) *ConsCell {
+	if c != nil {
+		c.pos = pos
+	}
+	return c
+}
+
 func (c *ConsCell) SetCar(v any) { c.car = v }
 func (c *ConsCell) SetCdr(v any) { c.cdr = v }
 
@@ -91,29 +117,7 @@ func toStr(v any) string {
 	}
 }
 
-func (c *ConsCell) String() string { // in some scheme version also: (. x) is x
-	if IsNil(c) { // we are defenitely CONS, so '()', not just generic 'nil'
-		return "()"
-	}
-	var sb strings.Builder
-	for {
-		sb.WriteString(toStr(c.Car()))
-		if p, ok := c.Cdr().(*ConsCell); ok { // nil also can be casted to *ConsCell
-			if !IsNil(c.Cdr()) {
-				sb.WriteString(" ")
-				c = p
-			} else {
-				break
-			}
-		} else {
-			if !IsEmptyList(c.Cdr()) { // pair
-				sb.WriteString(" . " + toStr(c.Cdr()))
-			}
-			break
-		}
-	}
-	return "(" + sb.String() + ")"
-}
+func (c *ConsCell) String() string { return writeString(c) } // in some scheme version also: (. x) is x
 
 func (c *ConsCell) DebugString() string { // (. x) -> x
 	if IsNil(c) {
@@ -139,16 +143,6 @@ func (c *ConsCell) DebugString() string { // (. x) -> x
 	return "(" + sb.String() + ")"
 }
 
-type Array struct{ storage []any }
-
-func (a Array) Car() any { return a.storage[0] }
-func (a Array) Cdr() any { return a.storage[1:] }
-func (a Array) String() string {
-	return "[" + strings.Join(functional.Map(func(v any) string {
-		return v.(fmt.Stringer).String()
-	}, a.storage), " ") + "]"
-}
-
 func ConsToGoList(p Pair) []any {
 	var res []any
 	for {
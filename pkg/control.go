@@ -0,0 +1,62 @@
+package lisp
+
+// Continuations are escaping only: the evaluator keeps its state on the Go
+// stack, so a continuation is a panic unwinding to the call/cc which created it.
+// Calling it after that call/cc returned can not restore the stack and fails.
+
+type (
+	continuation struct{ done bool }
+
+	continuationJump struct {
+		k     *continuation
+		value any
+	}
+)
+
+func CallCC(ctx *LocalScope, fn *Func) (res any) {
+	k := &continuation{}
+	escape := &Func{
+		args: ExprOfAny(Atomic("values")),
+		fn: func(ls *LocalScope, p Pair) any {
+			if k.done {
+				panic(ContinuationExpired)
+			}
+			var value any
+			if !IsEmptyList(p) {
+				value = p.Car()
+			}
+			panic(&continuationJump{k: k, value: value})
+		},
+	}
+
+	th := ctx.dyn.currentThread()
+	m := th.mark()
+	defer func() {
+		k.done = true
+		if r := recover(); r != nil {
+			if jump, ok := r.(*continuationJump); ok && jump.k == k {
+				th.rewind(m)
+				res = jump.value
+			} else {
+				panic(r)
+			}
+		}
+	}()
+	return fn.Call(ctx, Cons(escape, nil))
+}
+
+// after runs on every exit from thunk: normal return, continuation call or an error;
+// its own calls are not interrupted and not counted, so it runs after an interruption
+// or an exceeded step limit too
+func DynamicWind(ctx *LocalScope, before, thunk, after *Func) any {
+	before.Call(ctx, nil)
+	th := ctx.dyn.currentThread()
+	m := th.mark()
+	defer func() {
+		stack := th.snapshot() // of the failure, for its backtrace
+		th.rewind(m)
+		th.sheltered(1, func() { after.Call(ctx, nil) })
+		th.restore(stack)
+	}()
+	return thunk.Call(ctx, nil)
+}
@@ -3,20 +3,18 @@ package lisp
 import (
 	"fmt"
 	"golisp/functional"
+	"math"
+	"math/big"
+	"math/rand/v2"
 )
 
-var Global = &LocalScope{defs: make(map[Atomic]any)}
-
-func init() {
-	RegisterBasicForms(Global)
-}
-
 func Define(ctx *LocalScope, args Pair) { // Pair of Expr
 	if IsNil(args) { // (define)
 		panic(SyntaxError{"define: wrong syntax"})
 	}
 
 	if IsEmptyList(args.Cdr()) { // nil: (define x)
+		ctx.checkWritable("define", args.Car().(Atomic))
 		ctx.Set(args.Car().(Atomic), nil) // nil -> no value
 	} else {
 		def, rest := ExprOfAny(args.Car()), args.Cdr()
@@ -24,10 +22,17 @@ func Define(ctx *LocalScope, args Pair) { // Pair of Expr
 			lambda := Lambda(ctx, ExprOfAny(def.sexp.Cdr()), // def.sexp.c.Cdr() of type '*ConsCell' instead of usual SExpression, see ****
 				functional.Map(ExprOfAny, ConsToGoList(PairOf(rest)))...)
 			name := def.sexp.Car().(Atomic)
+			ctx.checkWritable("define", name)
+			lambda.name = string(name)
 			ctx.Set(name, lambda)
 		} else { // value: (define x 1) (define (sum a b) (+ a b))
+			name := def.atom.(Atomic)
+			ctx.checkWritable("define", name)
 			value := ExprOfAny(rest.(Pair).Car()).Exec(ctx)
-			ctx.Set(def.atom.(Atomic), value)
+			if fn, ok := value.(*Func); ok && fn.name == "" {
+				fn.name = string(name)
+			}
+			ctx.Set(name, value)
 		}
 	}
 }
@@ -38,11 +43,15 @@ func Lambda(defCtx *LocalScope, argNames Expr, es ...Expr) *Func {
 		code: es,
 		fn: func(callCtx *LocalScope, argValues Pair) any {
 			newCtx := defCtx.Sub() // use callCtx for dynamic scoping
+			newCtx.dyn = callCtx.dyn
 			cons := argValues
 
 			if argNames.isSExpr { // (lambda (a b . c) ...)
 				var args any = argNames.sexp // maybe nil
 				for ; IsCons(args) && !IsNil(args); args, cons = args.(Pair).Cdr(), PairOf(cons.Cdr()) {
+					if IsEmptyList(cons) {
+						panic(TooFewArguments)
+					}
 					newCtx.Set(args.(Pair).Car().(Atomic), cons.Car())
 				}
 
@@ -62,15 +71,22 @@ func Lambda(defCtx *LocalScope, argNames Expr, es ...Expr) *Func {
 				newCtx.Set(argNames.atom.(Atomic), cons)
 			}
 
-			var res any
-			for _, e := range es {
-				res = e.Exec(newCtx)
-			}
-			return res
+			return execBody(newCtx, es)
 		},
 	}
 }
 
+// executes all the expressions but the last one, which is left as a tail call
+func execBody(ctx *LocalScope, es []Expr) any {
+	if len(es) == 0 {
+		return nil
+	}
+	for _, e := range es[:len(es)-1] {
+		e.Exec(ctx)
+	}
+	return &tailCall{es[len(es)-1], ctx}
+}
+
 func RegisterBasicForms(global *LocalScope) {
 	global.Set("true", True)
 	global.Set("false", False)
@@ -91,6 +107,7 @@ func RegisterBasicForms(global *LocalScope) {
 	global.Set("cons", &Func{args: ExprOfAny(ConsList[Atomic]("a", "b")),
 		fn: func(ls *LocalScope, args Pair) any {
 			head, tail := args.Car(), args.Cdr().(Pair).Car()
+			ls.allocate(1, 0)
 			return Cons(head, tail)
 		},
 	})
@@ -120,7 +137,7 @@ func RegisterBasicForms(global *LocalScope) {
 		macro: true,
 		args:  ExprOfAny(ConsList[Atomic]("list")),
 		fn: func(ls *LocalScope, p Pair) any {
-			return p.Car() // just do not evaluate it as other macros do
+			return syntaxToDatum(p.Car()) // just do not evaluate it as other macros do
 		},
 	})
 
@@ -153,8 +170,19 @@ func RegisterBasicForms(global *LocalScope) {
 		fn: func(ls *LocalScope, p Pair) any {
 			name := p.Car().(Atomic)
 			value := p.Cdr().(Pair).Car()
-			if !ls.Update(name, ExprOfAny(value).Exec(ls)) { // in `!ls.Update(name, value)` value is atom|cons, not evaluated as set! is a macro
-				panic(UnboundError{name})
+			if holder := ls.holder(name); holder != nil {
+				holder.checkWritable("set!", name)
+			}
+			value = ExprOfAny(value).Exec(ls)
+			for !ls.Update(name, value) { // in `!ls.Update(name, value)` value is atom|cons, not evaluated as set! is a macro
+				al, ok := aliasOf(ls, name)
+				if !ok {
+					panic(UnboundError{name})
+				}
+				ls, name = al.env, al.name
+				if holder := ls.holder(name); holder != nil {
+					holder.checkWritable("set!", name)
+				}
 			}
 			return nil
 		},
@@ -169,7 +197,7 @@ func RegisterBasicForms(global *LocalScope) {
 	global.Set("eval", &Func{ // better need context
 		args: ExprOfAny(ConsList[Atomic]("code")),
 		fn: func(ls *LocalScope, p Pair) any {
-			return ExprOfAny(p.Car()).Exec(ls)
+			return &tailCall{p.Car(), ls}
 		},
 	})
 
@@ -182,42 +210,50 @@ func RegisterBasicForms(global *LocalScope) {
 		},
 	})
 
-	global.Set("display", &Func{
-		args: ExprOfAny(ConsList[Atomic]("str")),
+	callCC := &Func{
+		args: ExprOfAny(ConsList[Atomic]("proc")),
 		fn: func(ls *LocalScope, p Pair) any {
-			fmt.Println(p.Car().(fmt.Stringer))
-			return nil
+			return CallCC(ls, p.Car().(*Func))
 		},
-	})
+	}
+	global.Set("call-with-current-continuation", callCC)
+	global.Set("call/cc", callCC)
 
-	global.Set("println", &Func{
-		args: ExprOfAny(ConsList[Atomic]("str")),
+	global.Set("dynamic-wind", &Func{
+		args: ExprOfAny(ConsList[Atomic]("before", "thunk", "after")),
 		fn: func(ls *LocalScope, p Pair) any {
-			fmt.Println(string(p.Car().(RawString)))
-			return nil
+			a := ConsToGoList(p)
+			if len(a) != 3 {
+				panic(SyntaxError{"dynamic-wind: wrong syntax"})
+			}
+			return DynamicWind(ls, a[0].(*Func), a[1].(*Func), a[2].(*Func))
 		},
 	})
 
-	global.Set("debug", &Func{
-		args: ExprOfAny(ConsList[Atomic]("obj")),
-		fn: func(ls *LocalScope, p Pair) any {
-			fmt.Println(p.Car().(DebugStringer).DebugString())
+	// (println obj [port]) prints a line to the current output port by default
+	lineWriter := func(name string, str func(ls *LocalScope, v any) string) *Func {
+		return builtinFunc(ConsListDotted[Atomic]("obj", "port"), func(ls *LocalScope, args []any) any {
+			checkArity(args, 1, 2)
+			portOf(name, args, 1, ls.currentPorts().out).write(name, str(ls, args[0])+"\n")
 			return nil
-		},
-	})
+		})
+	}
+	global.Set("println", lineWriter("println", func(ls *LocalScope, v any) string {
+		return (&printer{display: true, ls: ls}).print(v)
+	}))
+	global.Set("debug", lineWriter("debug", func(ls *LocalScope, v any) string { return v.(DebugStringer).DebugString() }))
 
 	global.Set("strlen", &Func{
 		args: ExprOfAny(ConsList[Atomic]("str")),
 		fn: func(ls *LocalScope, p Pair) any {
-			return Number(len(p.Car().(RawString)))
+			return Integer(len(p.Car().(RawString)))
 		},
 	})
 
-	global.Set("char", &Func{
-		args: ExprOfAny(ConsList[Atomic]("str i")),
+	global.Set("char", &Func{ // string-ref
+		args: ExprOfAny(ConsList[Atomic]("str", "i")),
 		fn: func(ls *LocalScope, p Pair) any {
-			i := int(p.Cdr().(Pair).Car().(Number))
-			return RawString(p.Car().(RawString)[i])
+			return stringRef(p.Car().(RawString), p.Cdr().(Pair).Car())
 		},
 	})
 
@@ -230,61 +266,224 @@ func RegisterBasicForms(global *LocalScope) {
 			cond := p.Car()
 			code := p.Cdr().(Pair)
 			t, f := code.Car(), code.Cdr()
-			if condRes := ExprOfAny(cond).Exec(ls); condRes != nil && condRes.(Boolable).Bool() {
-				return ExprOfAny(t).Exec(ls)
+			if IsTrue(ExprOfAny(cond).Exec(ls)) {
+				return &tailCall{t, ls}
 			} else if !IsEmptyList(f) {
 				if !IsEmptyList(f.(Pair).Cdr()) {
 					panic(SyntaxError{"if: wrong syntax"})
 				}
-				return ExprOfAny(f.(Pair).Car()).Exec(ls)
+				return &tailCall{f.(Pair).Car(), ls}
 			}
 			return nil
 		},
 	})
 
-	global.Set("+", &Func{fn: func(ls *LocalScope, p Pair) any {
-		return FoldlCons(func(cur, acc any) any {
-			return Number(cur.(Number) + acc.(Number))
-		}, Number(0), p)
-		// var res Number
-		// for a := p; a != nil; a = PairOf(a.Cdr()) {
-		// 	res += a.Car().(Number)
-		// }
-		// return res
-	}})
-	global.Set("*", &Func{fn: func(ls *LocalScope, p Pair) any {
-		return FoldlCons(func(cur, acc any) any {
-			return Number(cur.(Number) * acc.(Number))
-		}, Number(1), p)
-	}})
+	// R7RS contagion: exact operands give exact results, any inexact one makes it inexact
+	arithmetic := func(name string, unit any, op func(a, b any) any) *Func {
+		return builtinFunc(Atomic("xs"), func(ls *LocalScope, args []any) any {
+			res := unit
+			for _, a := range args {
+				res = op(res, numberOf(name, a))
+			}
+			return res
+		})
+	}
+	global.Set("+", arithmetic("+", Integer(0), numAdd))
+	global.Set("*", arithmetic("*", Integer(1), numMul))
+
+	// (- x) is the negation, (- x y ...) subtracts from x, so does / with division
+	inverse := func(name string, invert func(a any) any, op func(a, b any) any) *Func {
+		return builtinFunc(Cons(Atomic("x"), Atomic("xs")), func(ls *LocalScope, args []any) any {
+			checkArity(args, 1, math.MaxInt)
+			res := numberOf(name, args[0])
+			if len(args) == 1 {
+				return invert(res)
+			}
+			for _, a := range args[1:] {
+				res = op(res, numberOf(name, a))
+			}
+			return res
+		})
+	}
+	global.Set("-", inverse("-", numNeg, numSub)) // not 0 - x, which is 0.0 for 0.0
+	global.Set("/", inverse("/", func(a any) any { return numDiv(Integer(1), a) }, numDiv))
 
-	global.Set("-", &Func{fn: func(ls *LocalScope, p Pair) any {
-		l := ConsToGoList(p)
-		res := l[0].(Number)
-		if len(l) <= 1 {
-			return -res
-		} else {
-			for i := 1; i < len(l); i++ {
-				res -= l[i].(Number)
+	unary := func(name string, fn func(z any) any) *Func {
+		return builtinFunc(ConsList[Atomic]("z"), func(ls *LocalScope, args []any) any {
+			return fn(numberOf(name, checkArity(args, 1, 1)[0]))
+		})
+	}
+	// the functions of the math package, always inexact
+	float := func(name string, fn func(x float64) float64) *Func {
+		return unary(name, func(z any) any { return Number(fn(toFloat(z))) })
+	}
+	rounding := func(name string, inexact func(float64) float64, exact func(n, d *big.Int) *big.Int) *Func {
+		return unary(name, func(z any) any { return roundNumber(name, z, inexact, exact) })
+	}
+	global.Set("floor", rounding("floor", math.Floor, ratFloor))
+	global.Set("ceiling", rounding("ceiling", math.Ceil, ratCeiling))
+	global.Set("truncate", rounding("truncate", math.Trunc, ratTruncate))
+	global.Set("round", rounding("round", math.RoundToEven, ratRound))
+	global.Set("abs", unary("abs", numAbs))
+	global.Set("square", unary("square", func(z any) any { return numMul(z, z) }))
+	global.Set("sqrt", unary("sqrt", numSqrt))
+	global.Set("exp", float("exp", math.Exp))
+	global.Set("sin", float("sin", math.Sin))
+	global.Set("cos", float("cos", math.Cos))
+	global.Set("tan", float("tan", math.Tan))
+	global.Set("asin", float("asin", math.Asin))
+	global.Set("acos", float("acos", math.Acos))
+	// (atan y x) is the angle of the point (x, y)
+	global.Set("atan", builtinFunc(ConsListDotted[Atomic]("y", "x"), func(ls *LocalScope, args []any) any {
+		y := toFloat(numberOf("atan", checkArity(args, 1, 2)[0]))
+		if len(args) == 1 {
+			return Number(math.Atan(y))
+		}
+		return Number(math.Atan2(y, toFloat(numberOf("atan", args[1]))))
+	}))
+	// (log z base)
+	global.Set("log", builtinFunc(ConsListDotted[Atomic]("z", "base"), func(ls *LocalScope, args []any) any {
+		res := numLog(checkArity(args, 1, 2)[0])
+		if len(args) == 2 {
+			res /= numLog(args[1])
+		}
+		return Number(res)
+	}))
+	global.Set("expt", builtinFunc(ConsList[Atomic]("z1", "z2"), func(ls *LocalScope, args []any) any {
+		args = checkArity(args, 2, 2)
+		return numExpt(ls, args[0], args[1])
+	}))
+	global.Set("min", builtinFunc(Cons(Atomic("x"), Atomic("xs")), func(ls *LocalScope, args []any) any {
+		return numExtreme("min", checkArity(args, 1, math.MaxInt), -1)
+	}))
+	global.Set("max", builtinFunc(Cons(Atomic("x"), Atomic("xs")), func(ls *LocalScope, args []any) any {
+		return numExtreme("max", checkArity(args, 1, math.MaxInt), 1)
+	}))
+	// there are no multiple values: (exact-integer-sqrt 17) is (4 1), (floor/ -7 2) is (-4 1)
+	global.Set("exact-integer-sqrt", builtinFunc(ConsList[Atomic]("k"), func(ls *LocalScope, args []any) any {
+		s, r := exactIntegerSqrt(checkArity(args, 1, 1)[0])
+		return ConsList(s, r)
+	}))
+	division := func(name string, quo, rem func(x, y *big.Int) *big.Int) *Func {
+		return builtinFunc(ConsList[Atomic]("n1", "n2"), func(ls *LocalScope, args []any) any {
+			args = checkArity(args, 2, 2)
+			return ConsList(intDivision(name, args[0], args[1], quo), intDivision(name, args[0], args[1], rem))
+		})
+	}
+	global.Set("floor/", division("floor/", floorQuotient, modulo))
+	global.Set("truncate/", division("truncate/", quotient, remainder))
+
+	// (random-integer n [source]) in [0, n), (random-real [source]) in (0, 1)
+	random := NewRandomSource(rand.Uint64())
+	global.Set("make-random-source", builtinFunc(Atomic("seed"), func(ls *LocalScope, args []any) any {
+		if len(checkArity(args, 0, 1)) == 0 {
+			return NewRandomSource(rand.Uint64())
+		} else if seed, ok := args[0].(Integer); ok {
+			return NewRandomSource(uint64(seed))
+		}
+		panic(TypeError{fmt.Sprintf("make-random-source: <%s> is not a seed", toStr(args[0]))})
+	}))
+	global.Set("random-integer", builtinFunc(ConsListDotted[Atomic]("n", "source"), func(ls *LocalScope, args []any) any {
+		return randomSourceOf("random-integer", checkArity(args, 1, 2), 1, random).Integer(args[0])
+	}))
+	global.Set("random-real", builtinFunc(Atomic("source"), func(ls *LocalScope, args []any) any {
+		return Number(randomSourceOf("random-real", checkArity(args, 0, 1), 0, random).Real())
+	}))
+
+	numPredicate := func(pred func(any) bool) *Func {
+		return builtinFunc(ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+			return Boolean(pred(checkArity(args, 1, 1)[0]))
+		})
+	}
+	global.Set("number?", numPredicate(IsNumber))
+	global.Set("real?", numPredicate(IsNumber))
+	global.Set("rational?", numPredicate(func(v any) bool {
+		f, inexact := v.(Number)
+		return IsNumber(v) && (!inexact || !math.IsInf(float64(f), 0) && !math.IsNaN(float64(f)))
+	}))
+	global.Set("integer?", numPredicate(isInteger))
+	global.Set("exact-integer?", numPredicate(func(v any) bool { return isInteger(v) && IsExact(v) }))
+	global.Set("exact?", numPredicate(func(v any) bool { return IsExact(numberOf("exact?", v)) }))
+	global.Set("inexact?", numPredicate(func(v any) bool { return !IsExact(numberOf("inexact?", v)) }))
+
+	global.Set("exact", builtinFunc(ConsList[Atomic]("z"), func(ls *LocalScope, args []any) any {
+		return Exact(checkArity(args, 1, 1)[0])
+	}))
+	global.Set("inexact", builtinFunc(ConsList[Atomic]("z"), func(ls *LocalScope, args []any) any {
+		return Inexact(checkArity(args, 1, 1)[0])
+	}))
+
+	intDiv := func(name string, op func(x, y *big.Int) *big.Int) *Func {
+		return builtinFunc(ConsList[Atomic]("n1", "n2"), func(ls *LocalScope, args []any) any {
+			args = checkArity(args, 2, 2)
+			return intDivision(name, args[0], args[1], op)
+		})
+	}
+	global.Set("quotient", intDiv("quotient", quotient))
+	global.Set("remainder", intDiv("remainder", remainder))
+	global.Set("modulo", intDiv("modulo", modulo))
+
+	global.Set("numerator", builtinFunc(ConsList[Atomic]("q"), func(ls *LocalScope, args []any) any {
+		n, _ := ratParts("numerator", checkArity(args, 1, 1)[0])
+		return n
+	}))
+	global.Set("denominator", builtinFunc(ConsList[Atomic]("q"), func(ls *LocalScope, args []any) any {
+		_, d := ratParts("denominator", checkArity(args, 1, 1)[0])
+		return d
+	}))
+
+	// (gcd) is 0 and (lcm) is 1, the results are not negative
+	gcdLcm := func(name string, unit any, op func(a, b any) any) *Func {
+		return builtinFunc(Atomic("ns"), func(ls *LocalScope, args []any) any {
+			inexact := false
+			res := unit
+			for _, a := range args {
+				if !IsExact(integerOf(name, a)) {
+					a, inexact = Exact(a), true
+				}
+				res = op(res, a)
 			}
+			if inexact {
+				return Inexact(res)
+			}
+			return res
+		})
+	}
+	global.Set("gcd", gcdLcm("gcd", Integer(0), gcd))
+	global.Set("lcm", gcdLcm("lcm", Integer(1), func(a, b any) any {
+		if toBig(a).Sign() == 0 || toBig(b).Sign() == 0 {
+			return Integer(0)
 		}
-		return res
-	}})
+		return normBig(new(big.Int).Abs(toBig(numDiv(numMul(a, b), gcd(a, b)))))
+	}))
 
-	global.Set("/", &Func{fn: func(ls *LocalScope, p Pair) any {
-		l := ConsToGoList(p)
-		res := l[0].(Number)
-		if len(l) <= 1 {
-			return 1.0 / res
-		} else {
-			div := Number(1)
-			for i := 1; i < len(l); i++ {
-				div *= l[i].(Number)
-			}
-			res /= Number(div)
+	// the same syntax as the reader, (string->number "ff" 16) is 255, not a number is #f
+	radixOf := func(name string, args []any) int {
+		if len(args) < 2 {
+			return 10
 		}
-		return res
-	}})
+		r, ok := args[1].(Integer)
+		if !ok || r != 2 && r != 8 && r != 10 && r != 16 {
+			panic(TypeError{fmt.Sprintf("%s: radix must be 2, 8, 10 or 16, not %s", name, toStr(args[1]))})
+		}
+		return int(r)
+	}
+	global.Set("number->string", builtinFunc(ConsListDotted[Atomic]("z", "radix"), func(ls *LocalScope, args []any) any {
+		checkArity(args, 1, 2)
+		s := formatNumber(numberOf("number->string", args[0]), radixOf("number->string", args))
+		ls.allocate(0, len(s))
+		return RawString(s)
+	}))
+	global.Set("string->number", builtinFunc(ConsListDotted[Atomic]("string", "radix"), func(ls *LocalScope, args []any) any {
+		s, ok := checkArity(args, 1, 2)[0].(RawString)
+		if !ok {
+			panic(TypeError{fmt.Sprintf("string->number: <%s> is not a string", toStr(args[0]))})
+		}
+		if n, err := readNumber(ls, string(s), radixOf("string->number", args)); err == nil && n != nil {
+			return n
+		}
+		return False
+	}))
 
 	global.Set("null?", &Func{
 		fn: func(ls *LocalScope, p Pair) any { // p - list of args
@@ -308,50 +507,23 @@ func RegisterBasicForms(global *LocalScope) {
 		return True
 	}})
 
-	global.Set("=", &Func{fn: func(ls *LocalScope, p Pair) any { // scalars only, lists are compares as refs
-		a := ConsToGoList(p)
-		for i := range a {
-			if i > 0 && a[i-1].(Number) != a[i].(Number) {
-				return False
-			}
-		}
-		return True
-	}})
-
-	global.Set("<", &Func{fn: func(ls *LocalScope, p Pair) any {
-		a := ConsToGoList(p)
-		for i := range a {
-			if i > 0 && a[i-1].(Number) >= a[i].(Number) {
-				return False
-			}
-		}
-		return True
-	}})
-	global.Set("<=", &Func{fn: func(ls *LocalScope, p Pair) any {
-		a := ConsToGoList(p)
-		for i := range a {
-			if i > 0 && a[i-1].(Number) > a[i].(Number) {
-				return False
-			}
-		}
-		return True
-	}})
-	global.Set(">", &Func{fn: func(ls *LocalScope, p Pair) any {
-		a := ConsToGoList(p)
-		for i := range a {
-			if i > 0 && a[i-1].(Number) <= a[i].(Number) {
-				return False
-			}
-		}
-		return True
-	}})
-	global.Set(">=", &Func{fn: func(ls *LocalScope, p Pair) any {
-		a := ConsToGoList(p)
-		for i := range a {
-			if i > 0 && a[i-1].(Number) < a[i].(Number) {
-				return False
+	// comparisons of all the adjacent arguments, any NaN makes them false
+	comparison := func(name string, holds func(sign int) bool) *Func {
+		return builtinFunc(Atomic("xs"), func(ls *LocalScope, args []any) any {
+			for i := range args {
+				numberOf(name, args[i])
+				if i > 0 {
+					if sign, ok := numCompare(args[i-1], args[i]); !ok || !holds(sign) {
+						return False
+					}
+				}
 			}
-		}
-		return True
-	}})
+			return True
+		})
+	}
+	global.Set("=", comparison("=", func(sign int) bool { return sign == 0 }))
+	global.Set("<", comparison("<", func(sign int) bool { return sign < 0 }))
+	global.Set("<=", comparison("<=", func(sign int) bool { return sign <= 0 }))
+	global.Set(">", comparison(">", func(sign int) bool { return sign > 0 }))
+	global.Set(">=", comparison(">=", func(sign int) bool { return sign >= 0 }))
 }
@@ -1,15 +1,111 @@
 package lisp
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
 
 type SyntaxError struct{ msg string }
 type ExecError struct{ msg string }
 type UnboundError struct{ symbol Atomic }
+type ArityError struct{ msg string }
+type TypeError struct{ msg string }
+
+// InterruptError stops the evaluation when its context is done
+type InterruptError struct{ Cause error }
+
+// ErrorObject is created by `error`, or wraps a Go error caught by Lisp code
+type ErrorObject struct {
+	message   string
+	irritants *ConsCell
+	cause     error
+}
+
+// Raised carries an object thrown by `raise` or `raise-continuable` up the Go stack
+type Raised struct {
+	Payload     any
+	Continuable bool
+}
 
 func (e SyntaxError) Error() string  { return "syntax error: " + e.msg }
 func (e ExecError) Error() string    { return e.msg }
 func (u UnboundError) Error() string { return fmt.Sprintf("unbound variable: '%s'", u.symbol) }
+func (e ArityError) Error() string   { return e.msg }
+func (e TypeError) Error() string    { return "type error: " + e.msg }
+func (r Raised) Error() string       { return "uncaught exception: " + toStr(r.Payload) }
+
+func (e InterruptError) Error() string { return "interrupted: " + e.Cause.Error() }
+func (e InterruptError) Unwrap() error { return e.Cause }
+
+func (e *ErrorObject) Error() string {
+	if IsEmptyList(e.irritants) {
+		return e.message
+	}
+	irritants := toStr(e.irritants)
+	return e.message + ": " + irritants[1:len(irritants)-1]
+}
+
+// error objects as seen from Lisp code: (error-object-message e), (error-object-irritants e)
+type Condition interface {
+	error
+	Message() string
+	Irritants() *ConsCell
+}
+
+func (e SyntaxError) Message() string       { return e.msg }
+func (e ExecError) Message() string         { return e.msg }
+func (e ArityError) Message() string        { return e.msg }
+func (e TypeError) Message() string         { return e.msg }
+func (InterruptError) Message() string      { return "interrupted" }
+func (u UnboundError) Message() string      { return "unbound variable" }
+func (e *ErrorObject) Message() string      { return e.message }
+func (SyntaxError) Irritants() *ConsCell    { return nil }
+func (ExecError) Irritants() *ConsCell      { return nil }
+func (ArityError) Irritants() *ConsCell     { return nil }
+func (TypeError) Irritants() *ConsCell      { return nil }
+func (InterruptError) Irritants() *ConsCell { return nil }
+
+func (u UnboundError) Irritants() *ConsCell { return Cons(u.symbol, nil) }
+func (e *ErrorObject) Irritants() *ConsCell { return e.irritants }
+func (e *ErrorObject) Unwrap() error        { return e.cause }
+
+func NewError(message string, irritants ...any) *ErrorObject {
+	e := &ErrorObject{message: message}
+	if len(irritants) > 0 {
+		e.irritants = ConsList(irritants...)
+	}
+	return e
+}
+
+// ConditionOf turns a recovered panic into the object Lisp handlers receive
+func ConditionOf(r any) any {
+	switch e := errorOf(r).(type) {
+	case Raised:
+		return e.Payload
+	case Condition:
+		return e
+	default:
+		return &ErrorObject{message: e.Error(), cause: e}
+	}
+}
+
+// errorOf turns a recovered panic into an error, failed type assertions of the builtins become TypeError
+func errorOf(r any) error {
+	var assertErr *runtime.TypeAssertionError
+	if err, ok := r.(error); !ok {
+		return fmt.Errorf("%v", r)
+	} else if errors.As(err, &assertErr) {
+		return TypeError{strings.TrimPrefix(err.Error(), "interface conversion: ")}
+	} else {
+		return err
+	}
+}
 
 var (
-	TooManyArguments = ExecError{"too many arguments"}
+	TooManyArguments    = ArityError{"too many arguments"}
+	TooFewArguments     = ArityError{"too few arguments"}
+	ContinuationExpired = ExecError{"continuation called outside of its extent, re-entering is not supported"}
+	HandlerReturned     = ExecError{"exception handler returned from non-continuable raise"}
 )
@@ -2,8 +2,9 @@ package lisp
 
 import (
 	"bytes"
-	"io"
-	"os"
+	"golisp/functional"
+	"golisp/parsing"
+	"runtime/debug"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,7 +17,7 @@ func Test_exec0(t *testing.T) {
 
 func Test_exec(t *testing.T) {
 	sexp := ParseSExpString(`(+ 1 2)`)
-	assert.Equal(t, Number(3), sexp.Exec(Global))
+	assert.Equal(t, Integer(3), sexp.Exec(Global))
 }
 
 func Test_exec2(t *testing.T) {
@@ -33,24 +34,24 @@ func Test_exec4(t *testing.T) {
 	sexp := ParseSExpString(`(define inc (lambda (x) (+ x 1)))`)
 	assert.Equal(t, nil, sexp.Exec(Global))
 	sexp = ParseSExpString(`(inc 10)`)
-	assert.Equal(t, Number(11), sexp.Exec(Global))
+	assert.Equal(t, Integer(11), sexp.Exec(Global))
 }
 
 func Test_exec_native(t *testing.T) {
 	sexp := ParseSExpString(`+`)
-	assert.Equal(t, `<lambda: (lambda () <native>)>`, toStr(sexp.Exec(Global)))
+	assert.Equal(t, `<lambda: (lambda xs <native>)>`, toStr(sexp.Exec(Global)))
 }
 
 func Test_exec5(t *testing.T) {
 	sexp := ParseSExpString(`(define (add2 x) (+ x 2))`)
 	assert.Equal(t, nil, sexp.Exec(Global))
 	sexp = ParseSExpString(`(add2 10)`)
-	assert.Equal(t, Number(12), sexp.Exec(Global))
+	assert.Equal(t, Integer(12), sexp.Exec(Global))
 }
 
 func Test_exec6(t *testing.T) {
 	sexp := ParseSExpString(`((lambda (x) (+ x 1)) 5)`)
-	assert.Equal(t, Number(6), sexp.Exec(Global))
+	assert.Equal(t, Integer(6), sexp.Exec(Global))
 }
 
 func Test_exec7(t *testing.T) {
@@ -59,16 +60,11 @@ func Test_exec7(t *testing.T) {
 }
 
 func captureOutput(main func(), testOutput func(string)) {
-	old := os.Stdout
-	defer func() { os.Stdout = old }()
-	r, w, _ := os.Pipe()
-	os.Stdout = w
+	var buf bytes.Buffer
+	Default.SetStdout(&buf)
+	defer Default.SetStdout(nil)
 
 	main()
-	w.Close()
-
-	var buf bytes.Buffer
-	io.Copy(&buf, r)
 	testOutput(buf.String())
 }
 
@@ -103,13 +99,13 @@ func Test_exec_func(t *testing.T) {
    		    1)))`)
 	assert.Nil(t, sexpF.Exec(Global))
 	sexp := ParseSExpString(`(fac 7)`)
-	assert.Equal(t, Number(5040), sexp.Exec(Global))
+	assert.Equal(t, Integer(5040), sexp.Exec(Global))
 }
 
 func Test_exec_lambda_multi(t *testing.T) {
 	captureOutput(func() {
 		sexp := ParseSExpString(`((lambda () 1 (println "intermediate") 3))`)
-		assert.Equal(t, Number(3), sexp.Exec(Global))
+		assert.Equal(t, Integer(3), sexp.Exec(Global))
 	}, func(s string) {
 		assert.Equal(t, "intermediate\n", s)
 	})
@@ -135,12 +131,12 @@ func Test_exec_apply_cons_car(t *testing.T) {
 		expect any
 		l      bool
 	}{
-		{code: `(apply + '(1 2))`, expect: Number(3)},
-		{code: `(apply + 1 '(2 3))`, expect: Number(6)},
-		{code: `(cons 1 '(2 3))`, expect: ConsList(Number(1), 2, 3), l: true},
-		{code: `(cons + '(2 3))`, expect: Cons(Atomic("+").Exec(Global), ConsList(Number(2), 3)), l: true},
-		{code: `(car '(1 2 3))`, expect: Number(1)},
-		{code: `(cdr '(1 2 3))`, expect: ConsList(Number(2), 3), l: true},
+		{code: `(apply + '(1 2))`, expect: Integer(3)},
+		{code: `(apply + 1 '(2 3))`, expect: Integer(6)},
+		{code: `(cons 1 '(2 3))`, expect: ConsList(Integer(1), 2, 3), l: true},
+		{code: `(cons + '(2 3))`, expect: Cons(Atomic("+").Exec(Global), ConsList(Integer(2), 3)), l: true},
+		{code: `(car '(1 2 3))`, expect: Integer(1)},
+		{code: `(cdr '(1 2 3))`, expect: ConsList(Integer(2), 3), l: true},
 	} {
 		sexp := ParseSExpString(test.code)
 		expect, res := test.expect, sexp.Exec(Global)
@@ -174,17 +170,17 @@ func Test_exec_empty(t *testing.T) {
 
 func Test_exec_closure_1(t *testing.T) {
 	ParseSExpString(`(define ten (lambda () 10))`).Exec(Global)
-	assert.Equal(t, Number(10), ParseSExpString(`(ten)`).Exec(Global))
+	assert.Equal(t, Integer(10), ParseSExpString(`(ten)`).Exec(Global))
 }
 
 func Test_exec_closure_2(t *testing.T) {
 	ParseSExpString(`(define (f a) (lambda () a))`).Exec(Global)
-	assert.Equal(t, Number(10), ParseSExpString(`((f 10))`).Exec(Global))
+	assert.Equal(t, Integer(10), ParseSExpString(`((f 10))`).Exec(Global))
 }
 
 func Test_exec_list(t *testing.T) {
 	lst := ParseSExpString(`'(1 2 3 nil ())`).Exec(Global)
-	res := Cons(Number(1), Cons(Number(2), Cons(Number(3), Cons(Atomic("nil"), Cons(EmptyList, EmptyList)))))
+	res := Cons(Integer(1), Cons(Integer(2), Cons(Integer(3), Cons(Atomic("nil"), Cons(EmptyList, EmptyList)))))
 	assert.Equal(t, toStr(res), toStr(lst))
 }
 
@@ -194,18 +190,18 @@ func Test_macros_and_unfolds(t *testing.T) {
 		expect any
 	}{
 		// macro:
-		{"`,(+ 1 2)", Number(3)}, // 3 (self-evaluated form)
-		{"((lambda (a) `(+ ,a)) 10)", Cons(Atomic("+"), Cons(Number(10), nil))},       // (+ 10)
-		{"((lambda a `(+ ,@a)) 1 2 3)", Cons(Atomic("+"), ConsList[Number](1, 2, 3))}, // (+ 1 2 3)
+		{"`,(+ 1 2)", Integer(3)}, // 3 (self-evaluated form)
+		{"((lambda (a) `(+ ,a)) 10)", Cons(Atomic("+"), Cons(Integer(10), nil))},       // (+ 10)
+		{"((lambda a `(+ ,@a)) 1 2 3)", Cons(Atomic("+"), ConsList[Integer](1, 2, 3))}, // (+ 1 2 3)
 		// `(+ 1 ,@'(2 3)) -> (+ 1 2 3)
 		// `(+ 1 ,@(2 3)) -> error
-		{"((lambda (a) `(+ 1 ,@a)) 1)", Cons(Atomic("+"), Cons(Number(1), Number(1)))}, // (+ 1 . 1)
+		{"((lambda (a) `(+ 1 ,@a)) 1)", Cons(Atomic("+"), Cons(Integer(1), Integer(1)))}, // (+ 1 . 1)
 
 		// unfold:
-		{"`(1 ,@'(2 3))", ConsList(Number(1), 2, 3)}, // (1 2 3)
-		{"`(1 ,@'())", Cons(Number(1), EmptyList)},   // (1)
-		{"`(1 ,@'() 2)", ConsList[Number](1, 2)},     // (1 2)
-		{"`(,@'())", EmptyList},                      // () or <nil>
+		{"`(1 ,@'(2 3))", ConsList(Integer(1), 2, 3)}, // (1 2 3)
+		{"`(1 ,@'())", Cons(Integer(1), EmptyList)},   // (1)
+		{"`(1 ,@'() 2)", ConsList[Integer](1, 2)},     // (1 2)
+		{"`(,@'())", EmptyList},                       // () or <nil>
 	} {
 		sexp := ParseSExpString(test.code)
 		assert.Equal(t, toStr(test.expect), toStr(sexp.Exec(Global)))
@@ -222,7 +218,7 @@ func Test_macro_unpack_in_the_middle(t *testing.T) {
 		}()
 		ParseSExpString("((lambda (a) `(+ 1 ,@a 3)) 1)").Exec(Global)
 	})
-	assert.Equal(t, toStr(Cons(Atomic("+"), ConsList[Number](1, 2, 3, 4, 5))),
+	assert.Equal(t, toStr(Cons(Atomic("+"), ConsList[Integer](1, 2, 3, 4, 5))),
 		toStr(ParseSExpString("((lambda a `(+ 1 ,@a 5)) 2 3 4)").Exec(Global))) // (+ 1 2 3 4 5)
 	// unfold:
 	assert.Panics(t, func() { // err, <2> not applicable
@@ -231,7 +227,7 @@ func Test_macro_unpack_in_the_middle(t *testing.T) {
 }
 
 func Test_fn_x(t *testing.T) {
-	assert.Equal(t, toStr(ConsList[Number](1, 2, 3, 4, 5)),
+	assert.Equal(t, toStr(ConsList[Integer](1, 2, 3, 4, 5)),
 		toStr(ParseSExpString("(cons 1 ((lambda x x) 2 3 4 5))").Exec(Global))) // (1 2 3 4 5)
 }
 
@@ -244,7 +240,7 @@ func Test_fn_1(t *testing.T) {
 		`).Exec(Global)
 	ParseSExpString(`(define inc (lambda (x) (+ 1 x)))`).Exec(Global)
 
-	assert.Equal(t, toStr(ConsList[Number](2, 3, 4)), toStr(ParseSExpString(`(map-1 inc '(1 2 3))`).Exec(Global)))
+	assert.Equal(t, toStr(ConsList[Integer](2, 3, 4)), toStr(ParseSExpString(`(map-1 inc '(1 2 3))`).Exec(Global)))
 }
 
 func Test_fn_2(t *testing.T) {
@@ -273,7 +269,7 @@ func Test_macro_def_1(t *testing.T) {
 	assert.Equal(t, "((lambda (a b) (+ a b)) 1 2)", toStr(res))
 
 	sexp := ParseSExpString("(let ((a 1) (b 2)) (+ a b))")
-	assert.Equal(t, Number(3), sexp.Exec(Global))
+	assert.Equal(t, Integer(3), sexp.Exec(Global))
 }
 
 // func Test_gap_1(t *testing.T) {
@@ -286,3 +282,132 @@ func Test_macro_def_1(t *testing.T) {
 //                    x y)
 //    (+ x
 //       y)))
+
+func Test_tail_calls(t *testing.T) {
+	// without tail calls the loops below need far more than that
+	defer debug.SetMaxStack(debug.SetMaxStack(8 << 20))
+
+	ParseSExpString(`
+		(define (count-down n acc)
+			(if (= n 0) acc
+				(count-down (- n 1) (cons n acc))))`).Exec(Global)
+	ParseSExpString(`
+		(define (len-acc l r)
+			(if (null? l) r
+				(len-acc (cdr l) (+ r 1))))`).Exec(Global)
+	ParseSExpString(`(define big (count-down 100000 '()))`).Exec(Global)
+	assert.Equal(t, Integer(100000), ParseSExpString(`(len-acc big 0)`).Exec(Global))
+
+	ParseSExpString("(defmacro my-unless (c . es) `(if ,c #f ((lambda () ,@es))))").Exec(Global)
+	ParseSExpString(`
+		(define (skip l)
+			(my-unless (null? l)
+				(skip (cdr l))))`).Exec(Global)
+	assert.Equal(t, False, ParseSExpString(`(skip big)`).Exec(Global))
+	assert.Equal(t, Integer(100000), ParseSExpString(`(apply len-acc big '(0))`).Exec(Global))
+}
+
+func Test_call_cc(t *testing.T) {
+	assert.Equal(t, Integer(3), ParseSExpString(`(+ 1 (call/cc (lambda (k) (+ 10 (k 2)))))`).Exec(Global))
+	assert.Equal(t, Integer(11), ParseSExpString(`(+ 1 (call-with-current-continuation (lambda (k) 10)))`).Exec(Global))
+
+	ParseSExpString(`
+		(define (find-first pred l)
+			(call/cc (lambda (return)
+				(define (walk l)
+					(if (null? l) #f
+						(if (pred (car l)) (return (car l)) (walk (cdr l)))))
+				(walk l))))`).Exec(Global)
+	assert.Equal(t, Integer(3), ParseSExpString(`(find-first (lambda (x) (> x 2)) '(1 2 3 4))`).Exec(Global))
+	assert.Equal(t, False, ParseSExpString(`(find-first (lambda (x) (> x 5)) '(1 2 3 4))`).Exec(Global))
+
+	ParseSExpString(`(define saved #f)`).Exec(Global)
+	ParseSExpString(`(call/cc (lambda (k) (set! saved k)))`).Exec(Global)
+	assert.PanicsWithValue(t, ContinuationExpired, func() { ParseSExpString(`(saved 1)`).Exec(Global) })
+}
+
+func Test_dynamic_wind(t *testing.T) {
+	ParseSExpString(`(define trace '())`).Exec(Global)
+	ParseSExpString(`(define (note x) (set! trace (cons x trace)))`).Exec(Global)
+
+	res := ParseSExpString(`
+		(call/cc (lambda (k)
+			(dynamic-wind
+				(lambda () (note 'before))
+				(lambda () (k 'escaped) (note 'unreachable))
+				(lambda () (note 'after)))))`).Exec(Global)
+	assert.Equal(t, Atomic("escaped"), res)
+	assert.Equal(t, "(after before)", toStr(ParseSExpString(`trace`).Exec(Global)))
+
+	ParseSExpString(`(set! trace '())`).Exec(Global)
+	assert.Equal(t, Integer(1), ParseSExpString(`
+		(dynamic-wind (lambda () (note 'in)) (lambda () 1) (lambda () (note 'out)))`).Exec(Global))
+	assert.Equal(t, "(out in)", toStr(ParseSExpString(`trace`).Exec(Global)))
+
+	ParseSExpString(`(set! trace '())`).Exec(Global)
+	assert.Panics(t, func() {
+		ParseSExpString(`(dynamic-wind (lambda () 1) (lambda () (car 1)) (lambda () (note 'out)))`).Exec(Global)
+	})
+	assert.Equal(t, "(out)", toStr(ParseSExpString(`trace`).Exec(Global)))
+}
+
+func Test_exceptions(t *testing.T) {
+	for _, test := range []struct {
+		code, expect string
+	}{
+		{`(guard (e (#t (error-object-message e))) (error "bad thing" 1 2))`, `"bad thing"`},
+		{`(guard (e (#t (error-object-irritants e))) (error "bad thing" 1 2))`, `(1 2)`},
+		{`(guard (e ((symbol? e) (cons 'sym e)) ((error-object? e) 'err)) (raise 'oops))`, `(sym . oops)`},
+		{`(guard (e ((symbol? e) 'sym) ((error-object? e) 'err)) (error "x"))`, `err`},
+		{`(guard (e ((unbound-variable-error? e) (error-object-irritants e))) (+ 1 no-such-var))`, `(no-such-var)`},
+		{`(guard (e ((error-object? e) 'err)) (car 1))`, `err`},
+		{`(guard (e (else 'caught)) 1 2 3)`, `3`},
+		{`(guard (e ((symbol? e) => (lambda (x) (cons x e)))) (raise 'a))`, `(#t . a)`},
+		{`(guard (e ((symbol? e))) (raise 'b))`, `#t`},
+		{`(guard (outer (#t (cons 'outer outer))) (guard (inner ((symbol? inner) 'inner)) (raise 42)))`, `(outer . 42)`},
+		{`(with-exception-handler (lambda (e) 42) (lambda () (+ (raise-continuable 'c) 1)))`, `43`},
+		{`(guard (e (#t (error-object-message e))) (with-exception-handler (lambda (e) 0) (lambda () (raise 'x))))`,
+			`"exception handler returned from non-continuable raise"`},
+		{`(call/cc (lambda (k) (with-exception-handler (lambda (e) (k (cons 'handled (error-object? e)))) (lambda () (car 1) 'not-here))))`,
+			`(handled . #t)`},
+		{`(guard (e (#t (cons 'guard e))) (+ 1 (raise-continuable 5)))`, `(guard . 5)`},
+		{`(guard (e (#t e)) (with-exception-handler (lambda (e) (raise (cons 'wrapped e))) (lambda () (raise 'inner))))`, `(wrapped . inner)`},
+	} {
+		assert.Equal(t, test.expect, toStr(ParseSExpString(test.code).Exec(Global)), test.code)
+	}
+
+	assert.PanicsWithValue(t, Raised{Payload: Atomic("boom")}, func() {
+		ParseSExpString(`(guard (e ((eq? e 'bang) 'no)) (raise 'boom))`).Exec(Global)
+	})
+}
+
+func Test_backtrace(t *testing.T) {
+	parser := NewSExpParser(parsing.NewStringSource(`
+(define (bt-helper x)
+  (car x))
+(define (bt-fac n)
+  (if (= n 0)
+      (bt-helper n)
+      (* n (bt-fac (- n 1)))))
+(bt-fac 2)`).Named("math.scm"))
+	for i := 0; i < 2; i++ {
+		_, err := parser.ParseSExp().Eval(Global)
+		assert.NoError(t, err)
+	}
+	expr := parser.ParseSExp()
+	assert.Equal(t, "math.scm:8:1", expr.Pos().String())
+
+	_, err := expr.Eval(Global)
+	var evalErr *EvalError
+	assert.ErrorAs(t, err, &evalErr)
+	assert.Equal(t, []string{
+		"at bt-helper (math.scm:3:3)",
+		"at bt-fac (math.scm:7:12)",
+		"at bt-fac (math.scm:7:12)",
+		"at toplevel (math.scm:8:1)",
+	}, functional.Map(Frame.String, evalErr.Stack))
+
+	_, err = ParseSExpString(`(guard (e (#f 0)) (bt-fac 1))`).Eval(Global)
+	assert.ErrorAs(t, err, &evalErr)
+	assert.Len(t, evalErr.Stack, 3)
+}
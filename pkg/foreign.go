@@ -0,0 +1,100 @@
+package lisp
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// GoObject is a Go value opaque to Lisp code, which can only call its exported
+// methods (. obj Method args ...) and read its exported fields (.- obj Field).
+// The arguments and results are converted as for RegisterGo.
+type GoObject struct{ value reflect.Value }
+
+// WrapGo makes a foreign object of the non-nil value
+func WrapGo(v any) *GoObject { return &GoObject{reflect.ValueOf(v)} }
+
+func (o *GoObject) Value() any { return o.value.Interface() }
+
+func (o *GoObject) String() string {
+	switch o.value.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Sprintf("#<go %s %#x>", o.value.Type(), o.value.Pointer())
+	default:
+		return fmt.Sprintf("#<go %s %p>", o.value.Type(), o)
+	}
+}
+
+func (o *GoObject) Exec(*LocalScope) any { return o }
+func (o *GoObject) Bool() bool           { return true }
+
+func (o *GoObject) method(name Atomic) (reflect.Value, bool) {
+	m := o.value.MethodByName(string(name))
+	return m, m.IsValid()
+}
+
+func (o *GoObject) field(name Atomic) (reflect.Value, bool) {
+	v := o.value
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return v, false
+	}
+	f, ok := v.Type().FieldByName(string(name))
+	if !ok || !f.IsExported() {
+		return v, false
+	}
+	fv, err := v.FieldByIndexErr(f.Index)
+	return fv, err == nil
+}
+
+// (. obj Method args ...) and (.- obj Field): obj and args are evaluated, the names are not
+func foreignAccess(ls *LocalScope, p Pair) (*GoObject, Atomic, Pair) {
+	obj := ExprOfAny(p.Car()).Exec(ls)
+	o, ok := obj.(*GoObject)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("<%s> of type <%s> is not a Go object", toStr(obj), TypeOf(obj))})
+	}
+	rest, ok := p.Cdr().(Pair)
+	if !ok || IsEmptyList(rest) {
+		panic(SyntaxError{"member name expected"})
+	}
+	name, ok := rest.Car().(Atomic)
+	if !ok {
+		panic(SyntaxError{"member name expected"})
+	}
+	return o, name, PairOf(rest.Cdr())
+}
+
+func registerForeign(global *LocalScope) {
+	global.Set(".", &Func{ // (. obj Method args ...)
+		macro: true,
+		args:  ExprOfAny(Cons(Atomic("obj"), Cons(Atomic("method"), Atomic("args")))),
+		fn: func(ls *LocalScope, p Pair) any {
+			o, name, args := foreignAccess(ls, p)
+			m, ok := o.method(name)
+			if !ok {
+				panic(TypeError{fmt.Sprintf("%s has no method %s", o.value.Type(), name)})
+			}
+			return callGo(m, PairOf(MapCons(func(a any) any { return ExprOfAny(a).Exec(ls) }, args)))
+		},
+	})
+	global.Set(".-", &Func{ // (.- obj Field)
+		macro: true,
+		args:  ExprOfAny(ConsList[Atomic]("obj", "field")),
+		fn: func(ls *LocalScope, p Pair) any {
+			o, name, rest := foreignAccess(ls, p)
+			if !IsEmptyList(rest) {
+				panic(TooManyArguments)
+			}
+			f, ok := o.field(name)
+			if !ok {
+				panic(TypeError{fmt.Sprintf("%s has no field %s", o.value.Type(), name)})
+			}
+			return fromGo(f)
+		},
+	})
+}
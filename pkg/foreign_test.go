@@ -0,0 +1,56 @@
+package lisp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type counter struct {
+	Name  string
+	count int
+}
+
+func (c *counter) Add(n int) int { c.count += n; return c.count }
+func (c *counter) Fail() error   { return errors.New("failed " + c.Name) }
+
+func Test_GoObject(t *testing.T) {
+	interp := New()
+	global := interp.Global()
+	ctx := context.Background()
+
+	c := &counter{Name: "c"}
+	global.Set("c", WrapGo(c))
+	global.Set("day", WrapGo(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)))
+	RegisterGo(global, "compile", regexp.MustCompile)
+
+	for _, test := range []struct{ code, expected string }{
+		{`(. c Add 2)`, `2`},
+		{`(begin (. c Add 3) (. c Add 1))`, `6`},
+		{`(.- c Name)`, `"c"`},
+		{`(. day Year)`, `2024`},
+		{`(. (. day AddDate 0 1 0) Format "2006-01-02")`, `"2024-04-01"`},
+		{`(. (compile "a+") MatchString "baa")`, `#t`},
+		{`(guard (e (#t (error-object-message e))) (. c Fail))`, `"failed c"`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+	assert.Equal(t, 6, c.count)
+
+	assert.Equal(t, fmt.Sprintf("#<go *lisp.counter %p>", c), toStr(ParseSExpString(`c`).Exec(global)))
+	assert.Regexp(t, `^#<go time.Time 0x[0-9a-f]+>$`, toStr(ParseSExpString(`day`).Exec(global)))
+
+	for _, code := range []string{`(. c Missing)`, `(.- c count)`, `(. 1 Add 1)`, `(. c Add "x")`} {
+		_, err := interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(TypeError), code)
+	}
+	_, err := interp.EvalString(ctx, `(.x c)`)
+	assert.ErrorAs(t, err, new(UnboundError))
+}
@@ -0,0 +1,94 @@
+package lisp
+
+import (
+	"fmt"
+	"golisp/functional"
+	"reflect"
+)
+
+// Go functions as Lisp procedures: the arguments are converted to the parameter
+// types with ToGo, the results back to Lisp values with FromGo. A trailing error
+// result is raised when it is not nil.
+
+var errorType = reflect.TypeFor[error]()
+
+// RegisterGo binds name to the Go function fn, panics if fn is not a function
+func RegisterGo(scope *LocalScope, name Atomic, fn any) {
+	scope.Set(name, GoFunc(string(name), fn))
+}
+
+func GoFunc(name string, fn any) *Func {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func {
+		panic(fmt.Sprintf("%s: %T is not a function", name, fn))
+	}
+	return &Func{
+		name: name,
+		args: goParams(rv.Type()),
+		fn: func(ls *LocalScope, p Pair) any {
+			return callGo(rv, p)
+		},
+	}
+}
+
+// calls the Go function with the Lisp arguments, several results are returned as a list
+func callGo(fn reflect.Value, p Pair) any {
+	t := fn.Type()
+	out := fn.Call(goArgs(t, p))
+	if t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType {
+		if err := out[len(out)-1]; !err.IsNil() {
+			panic(err.Interface().(error))
+		}
+		out = out[:len(out)-1]
+	}
+	switch len(out) {
+	case 0:
+		return nil
+	case 1:
+		return fromGo(out[0])
+	default:
+		return ConsList(functional.Map(fromGo, out)...)
+	}
+}
+
+// the parameter list shown when the procedure is printed: (int string . []float64)
+func goParams(t reflect.Type) Expr {
+	if t.NumIn() == 0 {
+		return Expr{}
+	}
+	var params any
+	if t.IsVariadic() {
+		params = Atomic(t.In(t.NumIn() - 1).String())
+	}
+	for i := t.NumIn() - 1; i >= 0; i-- {
+		if i < t.NumIn()-1 || !t.IsVariadic() {
+			params = Cons(Atomic(t.In(i).String()), params)
+		}
+	}
+	return ExprOfAny(params)
+}
+
+func goArgs(t reflect.Type, p Pair) []reflect.Value {
+	var in []reflect.Value
+	last := t.NumIn() - 1
+	for i := 0; !IsEmptyList(p); i, p = i+1, PairOf(p.Cdr()) {
+		var pt reflect.Type
+		switch {
+		case i < last || i == last && !t.IsVariadic():
+			pt = t.In(i)
+		case t.IsVariadic():
+			pt = t.In(last).Elem()
+		default:
+			panic(TooManyArguments)
+		}
+		arg, err := toGo(p.Car(), pt)
+		if err != nil {
+			panic(TypeError{fmt.Sprintf("argument %d: %v", i+1, err)})
+		}
+		in = append(in, arg)
+	}
+	if required := t.NumIn(); len(in) < required && !(t.IsVariadic() && len(in) == required-1) {
+		panic(TooFewArguments)
+	}
+	return in
+}
@@ -0,0 +1,78 @@
+package lisp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type point struct {
+	X, Y int
+	Tag  string
+}
+
+var errNegative = errors.New("negative")
+
+func Test_RegisterGo(t *testing.T) {
+	interp := New()
+	global := interp.Global()
+	ctx := context.Background()
+
+	RegisterGo(global, "repeat", strings.Repeat)
+	RegisterGo(global, "sum", func(xs ...float64) (s float64) {
+		for _, x := range xs {
+			s += x
+		}
+		return s
+	})
+	RegisterGo(global, "join", func(sep string, parts []string) string { return strings.Join(parts, sep) })
+	RegisterGo(global, "lookup", func(m map[string]int, key string) (int, bool) { v, ok := m[key]; return v, ok })
+	RegisterGo(global, "move", func(p point, dx int) point { p.X += dx; return p })
+	RegisterGo(global, "checked-sqrt", func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, errNegative
+		}
+		return x / 2, nil
+	})
+	RegisterGo(global, "ignore", func(any) {})
+
+	for code, expected := range map[string]string{
+		`(repeat "ab" 3)`:                         `"ababab"`,
+		`(sum)`:                                   `0.0`,
+		`(sum 1 2 3.5)`:                           `6.5`,
+		`(join "," '("a" "b"))`:                   `"a,b"`,
+		`(lookup '((a . 1) ("b" . 2)) "b")`:       `(2 #t)`,
+		`(move '((X . 1) (y . 2) (Tag . "p")) 5)`: `((X . 6) (Y . 2) (Tag . "p"))`,
+		`(checked-sqrt 8)`:                        `4.0`,
+		`(ignore '(1 "a"))`:                       ``,
+		`(guard (e ((error-object? e) (error-object-message e))) (checked-sqrt (- 0 1)))`: `"negative"`,
+	} {
+		res, err := interp.EvalString(ctx, code)
+		assert.NoError(t, err, code)
+		assert.Equal(t, expected, toStr(res), code)
+	}
+
+	_, err := interp.EvalString(ctx, `(checked-sqrt (- 0 1))`)
+	assert.ErrorIs(t, err, errNegative)
+	_, err = interp.EvalString(ctx, `(guard (e (#f 0)) (checked-sqrt (- 0 1)))`)
+	assert.ErrorIs(t, err, errNegative)
+
+	for code, check := range map[string]func(error) bool{
+		`(repeat "ab" 1.5)`:       func(err error) bool { return errors.As(err, new(TypeError)) },
+		`(repeat 1 1)`:            func(err error) bool { return errors.As(err, new(TypeError)) },
+		`(move '((Z . 1)) 1)`:     func(err error) bool { return errors.As(err, new(TypeError)) },
+		`(repeat "ab")`:           func(err error) bool { return errors.Is(err, TooFewArguments) },
+		`(repeat "ab" 1 2)`:       func(err error) bool { return errors.Is(err, TooManyArguments) },
+		`(join "," '("a" . "b"))`: func(err error) bool { return errors.As(err, new(TypeError)) },
+		`(sum 1 "2")`:             func(err error) bool { return errors.As(err, new(TypeError)) },
+	} {
+		_, err := interp.EvalString(ctx, code)
+		assert.True(t, check(err), "%s: %v", code, err)
+	}
+
+	assert.Equal(t, "<lambda: (lambda (string int) <native>)>", toStr(ParseSExpString(`repeat`).Exec(global)))
+	assert.Equal(t, "<lambda: (lambda []float64 <native>)>", toStr(ParseSExpString(`sum`).Exec(global)))
+}
@@ -0,0 +1,709 @@
+package lisp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Comparator decides which keys of a hash table are the same:
+// Equal keys must have == hashes
+type Comparator struct {
+	Hash  func(any) any
+	Equal func(a, b any) bool
+
+	hash, equal *Func // of make-hash-table, called in the scope of the builtins, Hash and Equal are for Go
+}
+
+// the hash of the key, the procedures of make-hash-table are called in ls if it is not nil
+func (c *Comparator) hashOf(ls *LocalScope, k any) any {
+	if c.hash != nil && ls != nil {
+		return eqvHash(c.hash.Call(ls, ConsList(k)))
+	}
+	return c.Hash(k)
+}
+
+func (c *Comparator) same(ls *LocalScope, a, b any) bool {
+	if c.equal != nil && ls != nil {
+		return IsTrue(c.equal.Call(ls, ConsList(a, b)))
+	}
+	return c.Equal(a, b)
+}
+
+var (
+	EqvComparator    = Comparator{Hash: eqvHash, Equal: Eqv}
+	EqualComparator  = Comparator{Hash: equalHash, Equal: Equal}
+	StringComparator = Comparator{
+		Hash: func(k any) any { return string(stringOf("string=?", k)) },
+		Equal: func(a, b any) bool {
+			return stringOf("string=?", a) == stringOf("string=?", b)
+		},
+	}
+	StringCIComparator = Comparator{
+		Hash: func(k any) any { return foldString(string(stringOf("string-ci=?", k))) },
+		Equal: func(a, b any) bool {
+			return foldString(string(stringOf("string-ci=?", a))) == foldString(string(stringOf("string-ci=?", b)))
+		},
+	}
+)
+
+// Eqv is eqv?: the same atom or the same object, eq? is the same here.
+// Inexact numbers are the same float: 0.0 is not -0.0, +nan.0 is itself.
+func Eqv(a, b any) bool {
+	if IsExact(a) && IsExact(b) { // big ones are pointers
+		sign, _ := numCompare(a, b)
+		return sign == 0
+	} else if x, ok := a.(Number); ok {
+		y, ok := b.(Number)
+		return ok && math.Float64bits(float64(x)) == math.Float64bits(float64(y))
+	}
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb {
+		return IsEmptyList(a) && IsEmptyList(b)
+	} else if ta == nil || !ta.Comparable() {
+		return ta == nil
+	}
+	return a == b
+}
+
+// Equal is equal?: lists and vectors with equal elements, equal strings, eqv otherwise.
+// It terminates on circular structures too, they are equal if their unfoldings are.
+// `x ,x and ,@x read are the lists (quasiquote x), (unquote x) and (unquote-splicing x).
+func Equal(a, b any) bool { return equal(nil, a, b) }
+
+// the list the reader abbreviation stands for, v itself if it is not one
+func unabbreviated(v any) any {
+	if a, ok := v.(abbreviation); ok {
+		return Cons(a.name(), Cons(a.datum(), EmptyList))
+	}
+	return v
+}
+
+// equal? checking th for interruptions, nil for none
+func equal(th *thread, a, b any) bool {
+	budget := 1000 // most are decided before the pairs compared have to be remembered
+	if res, ok := equalBounded(a, b, &budget); ok {
+		return res
+	}
+	return (&equality{th: th, assumed: map[[2]any]struct{}{}}).equal(a, b)
+}
+
+// the plain comparison of up to budget conses and vector elements, false if it is not decided
+func equalBounded(a, b any, budget *int) (res, ok bool) {
+	for {
+		a, b = unabbreviated(a), unabbreviated(b)
+		ca, ok1 := a.(*ConsCell)
+		cb, ok2 := b.(*ConsCell)
+		if !ok1 || !ok2 || ca == nil || cb == nil {
+			break
+		} else if ca == cb {
+			return true, true
+		} else if *budget--; *budget < 0 {
+			return false, false
+		} else if res, ok := equalBounded(ca.car, cb.car, budget); !ok || !res {
+			return res, ok
+		}
+		a, b = ca.cdr, cb.cdr
+	}
+	if va, ok := a.(*Array); ok {
+		vb, ok := b.(*Array)
+		if !ok || len(va.storage) != len(vb.storage) {
+			return false, true
+		}
+		for i := range va.storage {
+			if *budget--; *budget < 0 {
+				return false, false
+			} else if res, ok := equalBounded(va.storage[i], vb.storage[i], budget); !ok || !res {
+				return res, ok
+			}
+		}
+		return true, true
+	}
+	return Eqv(a, b), true
+}
+
+// the comparison of possibly circular structures: a pair of conses or vectors met again
+// is taken as equal, if it is not, the comparison in progress finds the difference
+type equality struct {
+	th      *thread
+	assumed map[[2]any]struct{}
+}
+
+func (e *equality) assume(a, b any) bool {
+	if _, ok := e.assumed[[2]any{a, b}]; ok {
+		return true
+	}
+	e.assumed[[2]any{a, b}] = struct{}{}
+	return false
+}
+
+func (e *equality) equal(a, b any) bool {
+	for {
+		e.th.checkpoint()
+		a, b = unabbreviated(a), unabbreviated(b)
+		ca, ok1 := a.(*ConsCell)
+		cb, ok2 := b.(*ConsCell)
+		if !ok1 || !ok2 || ca == nil || cb == nil {
+			break
+		} else if ca == cb || e.assume(ca, cb) {
+			return true
+		} else if !e.equal(ca.car, cb.car) {
+			return false
+		}
+		a, b = ca.cdr, cb.cdr
+	}
+	if va, ok := a.(*Array); ok {
+		vb, ok := b.(*Array)
+		if !ok || len(va.storage) != len(vb.storage) {
+			return false
+		} else if va == vb || e.assume(va, vb) {
+			return true
+		}
+		for i := range va.storage {
+			if !e.equal(va.storage[i], vb.storage[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return Eqv(a, b)
+}
+
+func eqvHash(k any) any {
+	switch k := k.(type) {
+	case *BigInt, *Rational:
+		return toStr(k)
+	}
+	if n, ok := k.(Number); ok { // +nan.0 is not == to itself
+		return math.Float64bits(float64(n))
+	} else if t := reflect.TypeOf(k); t != nil && !t.Comparable() {
+		return t // all in one bucket, not eqv to each other anyway
+	} else if IsEmptyList(k) {
+		return nil
+	}
+	return k
+}
+
+var hashSeed = maphash.MakeSeed()
+
+// the hash of equal? keys looks at a limited number of elements, so it works for long and circular lists
+func equalHash(k any) any {
+	switch k.(type) {
+	case *ConsCell, *Array, Quasiquoted, Unquoted, UnquotedSpliced:
+		var h maphash.Hash
+		h.SetSeed(hashSeed)
+		budget := 64
+		hashInto(&h, k, &budget)
+		return h.Sum64()
+	}
+	return eqvHash(k)
+}
+
+func hashInto(h *maphash.Hash, v any, budget *int) {
+	if *budget--; *budget < 0 {
+		return
+	}
+	switch v := unabbreviated(v).(type) {
+	case *ConsCell:
+		h.WriteByte('(')
+		for ; v != nil && *budget >= 0; v, _ = v.cdr.(*ConsCell) {
+			hashInto(h, v.car, budget)
+			if !IsEmptyList(v.cdr) && !IsCons(v.cdr) { // the lists of ConsList end with an untyped nil
+				h.WriteByte('.')
+				hashInto(h, v.cdr, budget)
+				break
+			}
+		}
+	case *Array:
+		h.WriteByte('#')
+		for i := 0; i < len(v.storage) && *budget >= 0; i++ {
+			hashInto(h, v.storage[i], budget)
+		}
+	case Number:
+		if v == 0 { // -0
+			v = 0
+		}
+		h.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(float64(v))))
+	case RawString, Char, Atomic, Keyword, Boolean, Integer, *BigInt, *Rational:
+		h.WriteString(TypeOf(v) + toStr(v))
+	default: // objects are only equal to themselves, the buckets are by type
+		if v != nil {
+			h.WriteString(TypeOf(v))
+		}
+	}
+}
+
+// HashTable is a mutable map with keys compared by its Comparator, it keeps
+// the insertion order. The concurrent ones can be shared between goroutines,
+// but updates are not atomic: they read and write the value separately.
+// The comparator is called without the lock, it may run Lisp code which uses the table.
+type HashTable struct {
+	cmp         Comparator
+	mu          *sync.RWMutex // nil if not concurrent
+	buckets     map[any][]*htEntry
+	first, last *htEntry
+	size        int
+	gen         int // changes when entries are added or removed
+}
+
+type htEntry struct {
+	key, value, hash any
+	prev, next       *htEntry
+}
+
+func NewHashTable(cmp Comparator) *HashTable {
+	return &HashTable{cmp: cmp, buckets: map[any][]*htEntry{}}
+}
+
+func NewConcurrentHashTable(cmp Comparator) *HashTable {
+	h := NewHashTable(cmp)
+	h.mu = &sync.RWMutex{}
+	return h
+}
+
+func (h *HashTable) rlock() func() {
+	if h.mu == nil {
+		return func() {}
+	}
+	h.mu.RLock()
+	return h.mu.RUnlock
+}
+
+func (h *HashTable) lock() func() {
+	if h.mu == nil {
+		return func() {}
+	}
+	h.mu.Lock()
+	return h.mu.Unlock
+}
+
+// the entry of the key in the table of generation gen, the comparator runs after the lock
+// is released: the bucket found is not changed afterwards, the removals make a new one
+func (h *HashTable) find(ls *LocalScope, key any) (hash any, e *htEntry, gen int) {
+	hash = h.cmp.hashOf(ls, key)
+	unlock := h.rlock()
+	bucket, gen := h.buckets[hash], h.gen
+	unlock()
+	for _, e := range bucket {
+		if h.cmp.same(ls, e.key, key) {
+			return hash, e, gen
+		}
+	}
+	return hash, nil, gen
+}
+
+// makes the change if no entry was added or removed since generation gen
+func (h *HashTable) ifUnchanged(gen int, change func()) bool {
+	defer h.lock()()
+	if h.gen != gen {
+		return false
+	}
+	change()
+	return true
+}
+
+func (h *HashTable) Get(key any) (any, bool) { return h.get(nil, key) }
+func (h *HashTable) Set(key, value any)      { h.set(nil, key, value) }
+
+// Delete returns false if there is no such key
+func (h *HashTable) Delete(key any) bool { return h.delete(nil, key) }
+
+// the operations calling the procedures of the comparator in ls
+func (h *HashTable) get(ls *LocalScope, key any) (any, bool) {
+	if _, e, _ := h.find(ls, key); e != nil {
+		defer h.rlock()()
+		return e.value, true
+	}
+	return nil, false
+}
+
+func (h *HashTable) set(ls *LocalScope, key, value any) {
+	for {
+		hash, e, gen := h.find(ls, key)
+		if h.ifUnchanged(gen, func() {
+			if e != nil {
+				e.value = value
+			} else {
+				h.insert(hash, key, value)
+			}
+		}) {
+			return
+		}
+	}
+}
+
+func (h *HashTable) delete(ls *LocalScope, key any) bool {
+	for {
+		_, e, gen := h.find(ls, key)
+		if e == nil {
+			return false
+		} else if h.ifUnchanged(gen, func() { h.remove(e) }) {
+			return true
+		}
+	}
+}
+
+// the locked changes
+func (h *HashTable) insert(hash, key, value any) {
+	e := &htEntry{key: key, value: value, hash: hash, prev: h.last}
+	if h.last != nil {
+		h.last.next = e
+	} else {
+		h.first = e
+	}
+	h.last = e
+	h.buckets[hash] = append(h.buckets[hash], e)
+	h.size++
+	h.gen++
+}
+
+func (h *HashTable) remove(e *htEntry) {
+	b := h.buckets[e.hash]
+	i := 0
+	for b[i] != e {
+		i++
+	}
+	if len(b) == 1 {
+		delete(h.buckets, e.hash)
+	} else {
+		h.buckets[e.hash] = append(b[:i:i], b[i+1:]...)
+	}
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		h.first = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		h.last = e.prev
+	}
+	h.size--
+	h.gen++
+}
+
+func (h *HashTable) Len() int {
+	defer h.rlock()()
+	return h.size
+}
+
+func (h *HashTable) Clear() {
+	defer h.lock()()
+	h.buckets, h.first, h.last, h.size = map[any][]*htEntry{}, nil, nil, 0
+	h.gen++
+}
+
+// Entries are the keys and the values in the insertion order
+func (h *HashTable) Entries() (keys, values []any) {
+	defer h.rlock()()
+	for e := h.first; e != nil; e = e.next {
+		keys, values = append(keys, e.key), append(values, e.value)
+	}
+	return keys, values
+}
+
+// Copy is a table of the same kind with the same entries
+func (h *HashTable) Copy() *HashTable {
+	res := NewHashTable(h.cmp)
+	if h.mu != nil {
+		res.mu = &sync.RWMutex{}
+	}
+	defer h.rlock()()
+	for e := h.first; e != nil; e = e.next {
+		res.insert(e.hash, e.key, e.value)
+	}
+	return res
+}
+
+func (h *HashTable) alist() *ConsCell {
+	keys, values := h.Entries()
+	var res *ConsCell
+	for i := len(keys) - 1; i >= 0; i-- {
+		res = Cons(Cons(keys[i], values[i]), res)
+	}
+	return res
+}
+
+func (h *HashTable) String() string {
+	var sb strings.Builder
+	sb.WriteString("#<hash-table")
+	keys, values := h.Entries()
+	for i, k := range keys {
+		sb.WriteString(" " + Cons(k, values[i]).String())
+	}
+	return sb.String() + ">"
+}
+
+func (h *HashTable) Exec(*LocalScope) any { return h }
+func (h *HashTable) Bool() bool           { return true }
+
+// the comparator of (make-hash-table equality [hash]), the builtin predicates have builtin hashes
+func comparatorOf(ls *LocalScope, args []any) Comparator {
+	if len(args) == 0 {
+		return EqualComparator
+	}
+	equality, ok := args[0].(*Func)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("<%s> is not an equality predicate", toStr(args[0]))})
+	}
+	for name, cmp := range map[Atomic]Comparator{
+		"eq?": EqvComparator, "eqv?": EqvComparator, "equal?": EqualComparator,
+		"string=?": StringComparator, "string-ci=?": StringCIComparator,
+	} {
+		if lookup(ls, name) == equality && len(args) == 1 {
+			return cmp
+		}
+	}
+	if len(args) < 2 {
+		panic(TypeError{"make-hash-table: a hash function is needed for " + toStr(equality)})
+	}
+	hash, ok := args[1].(*Func)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("<%s> is not a hash function", toStr(args[1]))})
+	}
+	// the Go callers of Get and Set have no scope, the procedures run on their own there
+	it := ls.Interpreter()
+	call := func(fn *Func, args ...any) any {
+		res, err := it.Call(context.Background(), fn, args...)
+		if evalErr := (*EvalError)(nil); errors.As(err, &evalErr) {
+			panic(evalErr.Err)
+		} else if err != nil {
+			panic(err)
+		}
+		return res
+	}
+	return Comparator{
+		Hash:  func(k any) any { return eqvHash(call(hash, k)) },
+		Equal: func(a, b any) bool { return IsTrue(call(equality, a, b)) },
+		hash:  hash,
+		equal: equality,
+	}
+}
+
+func hashTableOf(v any) *HashTable {
+	h, ok := v.(*HashTable)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("<%s> of type <%s> is not a hash table", toStr(v), TypeOf(v))})
+	}
+	return h
+}
+
+// the optional argument i, a procedure
+func optionalFunc(args []any, i int) *Func {
+	if i >= len(args) {
+		return nil
+	}
+	fn, ok := args[i].(*Func)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("<%s> is not a procedure", toStr(args[i]))})
+	}
+	return fn
+}
+
+// the value of the key, (failure) if it is missing, (success value) if present
+func hashTableRef(ls *LocalScope, name string, args []any) any {
+	if len(args) < 2 {
+		panic(TooFewArguments)
+	} else if len(args) > 4 {
+		panic(TooManyArguments)
+	}
+	failure, success := optionalFunc(args, 2), optionalFunc(args, 3)
+	v, ok := hashTableOf(args[0]).get(ls, args[1])
+	switch {
+	case !ok && failure != nil:
+		return failure.Call(ls, nil)
+	case !ok:
+		panic(NewError(name+": no value for the key", args[1]))
+	case success != nil:
+		return success.Call(ls, ConsList(v))
+	}
+	return v
+}
+
+func registerHashTables(global *LocalScope) {
+	builtin := func(name Atomic, params any, fn func(ls *LocalScope, args []any) any) {
+		global.Set(name, builtinFunc(params, fn))
+	}
+	// exactly n arguments
+	arity := func(args []any, n int) []any { return checkArity(args, n, n) }
+
+	global.Set("eqv?", &Func{
+		args: ExprOfAny(ConsList[Atomic]("a", "b")),
+		fn: func(ls *LocalScope, p Pair) any {
+			return Boolean(Eqv(p.Car(), PairOf(p.Cdr()).Car()))
+		},
+	})
+	global.Set("equal?", &Func{
+		args: ExprOfAny(ConsList[Atomic]("a", "b")),
+		fn: func(ls *LocalScope, p Pair) any {
+			return Boolean(equal(ls.dyn.currentThread(), p.Car(), PairOf(p.Cdr()).Car()))
+		},
+	})
+
+	builtin("make-hash-table", Cons(Atomic("equality"), Atomic("hash")), func(ls *LocalScope, args []any) any {
+		return NewHashTable(comparatorOf(ls, args))
+	})
+	builtin("make-concurrent-hash-table", Cons(Atomic("equality"), Atomic("hash")), func(ls *LocalScope, args []any) any {
+		h := NewHashTable(comparatorOf(ls, args))
+		h.mu = &sync.RWMutex{}
+		return h
+	})
+	builtin("alist->hash-table", Cons(Atomic("alist"), Cons(Atomic("equality"), Atomic("hash"))), func(ls *LocalScope, args []any) any {
+		if len(args) == 0 {
+			panic(TooFewArguments)
+		}
+		entries, ok := alistEntries(args[0])
+		if !ok {
+			panic(TypeError{fmt.Sprintf("<%s> is not an association list", toStr(args[0]))})
+		}
+		h := NewHashTable(comparatorOf(ls, args[1:]))
+		for _, e := range entries {
+			if _, ok := h.get(ls, e.Car()); !ok { // the first one wins as in assoc
+				h.set(ls, e.Car(), e.Cdr())
+			}
+		}
+		return h
+	})
+	builtin("hash-table?", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		_, ok := arity(args, 1)[0].(*HashTable)
+		return Boolean(ok)
+	})
+
+	builtin("hash-table-ref", ConsListDotted[Atomic]("table", "key", "failure+success"), func(ls *LocalScope, args []any) any {
+		return hashTableRef(ls, "hash-table-ref", args)
+	})
+	builtin("hash-table-ref/default", ConsList[Atomic]("table", "key", "default"), func(ls *LocalScope, args []any) any {
+		args = arity(args, 3)
+		if v, ok := hashTableOf(args[0]).get(ls, args[1]); ok {
+			return v
+		}
+		return args[2]
+	})
+	builtin("hash-table-contains?", ConsList[Atomic]("table", "key"), func(ls *LocalScope, args []any) any {
+		args = arity(args, 2)
+		_, ok := hashTableOf(args[0]).get(ls, args[1])
+		return Boolean(ok)
+	})
+	builtin("hash-table-set!", ConsListDotted[Atomic]("table", "key", "value", "more"), func(ls *LocalScope, args []any) any {
+		if len(args) < 3 || len(args)%2 == 0 {
+			panic(ArityError{"hash-table-set!: keys and values expected in pairs"})
+		}
+		h := hashTableOf(args[0])
+		for i := 1; i < len(args); i += 2 {
+			h.set(ls, args[i], args[i+1])
+		}
+		return nil
+	})
+	builtin("hash-table-delete!", ConsListDotted[Atomic]("table", "keys"), func(ls *LocalScope, args []any) any {
+		if len(args) == 0 {
+			panic(TooFewArguments)
+		}
+		h, n := hashTableOf(args[0]), 0
+		for _, k := range args[1:] {
+			if h.delete(ls, k) {
+				n++
+			}
+		}
+		return Integer(n)
+	})
+	// (hash-table-update! table key updater [failure [success]])
+	builtin("hash-table-update!", ConsListDotted[Atomic]("table", "key", "updater", "failure+success"), func(ls *LocalScope, args []any) any {
+		if len(args) < 3 {
+			panic(TooFewArguments)
+		}
+		updater := optionalFunc(args, 2)
+		v := hashTableRef(ls, "hash-table-update!", append([]any{args[0], args[1]}, args[3:]...))
+		hashTableOf(args[0]).set(ls, args[1], updater.Call(ls, ConsList(v)))
+		return nil
+	})
+	builtin("hash-table-update!/default", ConsList[Atomic]("table", "key", "updater", "default"), func(ls *LocalScope, args []any) any {
+		args = arity(args, 4)
+		h, updater := hashTableOf(args[0]), optionalFunc(args, 2)
+		v, ok := h.get(ls, args[1])
+		if !ok {
+			v = args[3]
+		}
+		h.set(ls, args[1], updater.Call(ls, ConsList(v)))
+		return nil
+	})
+
+	builtin("hash-table-count", ConsList[Atomic]("table"), func(ls *LocalScope, args []any) any {
+		return Integer(hashTableOf(arity(args, 1)[0]).Len())
+	})
+	global.Set("hash-table-size", lookup(global, "hash-table-count"))
+	builtin("hash-table-keys", ConsList[Atomic]("table"), func(ls *LocalScope, args []any) any {
+		keys, _ := hashTableOf(arity(args, 1)[0]).Entries()
+		if len(keys) == 0 {
+			return EmptyList
+		}
+		return ConsList(keys...)
+	})
+	builtin("hash-table-values", ConsList[Atomic]("table"), func(ls *LocalScope, args []any) any {
+		_, values := hashTableOf(arity(args, 1)[0]).Entries()
+		if len(values) == 0 {
+			return EmptyList
+		}
+		return ConsList(values...)
+	})
+	builtin("hash-table->alist", ConsList[Atomic]("table"), func(ls *LocalScope, args []any) any {
+		if res := hashTableOf(arity(args, 1)[0]).alist(); res != nil {
+			return res
+		}
+		return EmptyList
+	})
+	// the procedures see the entries at the moment of the call, they may change the table
+	builtin("hash-table-walk", ConsList[Atomic]("table", "proc"), func(ls *LocalScope, args []any) any {
+		args = arity(args, 2)
+		keys, values := hashTableOf(args[0]).Entries()
+		proc := optionalFunc(args, 1)
+		for i, k := range keys {
+			proc.Call(ls, ConsList(k, values[i]))
+		}
+		return nil
+	})
+	// (hash-table-fold kons knil table), or (hash-table-fold table kons knil) as in SRFI 69
+	builtin("hash-table-fold", ConsList[Atomic]("kons", "knil", "table"), func(ls *LocalScope, args []any) any {
+		args = arity(args, 3)
+		if _, ok := args[0].(*HashTable); ok {
+			args = []any{args[1], args[2], args[0]}
+		}
+		keys, values := hashTableOf(args[2]).Entries()
+		kons, acc := optionalFunc(args, 0), args[1]
+		for i, k := range keys {
+			acc = kons.Call(ls, ConsList(k, values[i], acc))
+		}
+		return acc
+	})
+	builtin("hash-table-copy", ConsList[Atomic]("table"), func(ls *LocalScope, args []any) any {
+		return hashTableOf(arity(args, 1)[0]).Copy()
+	})
+	builtin("hash-table-clear!", ConsList[Atomic]("table"), func(ls *LocalScope, args []any) any {
+		hashTableOf(arity(args, 1)[0]).Clear()
+		return nil
+	})
+
+	builtin("hash", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		var h maphash.Hash
+		h.SetSeed(hashSeed)
+		budget := 64
+		hashInto(&h, arity(args, 1)[0], &budget)
+		return Integer(h.Sum64() >> 1)
+	})
+	builtin("string-hash", ConsList[Atomic]("str"), func(ls *LocalScope, args []any) any {
+		s, ok := arity(args, 1)[0].(RawString)
+		if !ok {
+			panic(TypeError{fmt.Sprintf("<%s> is not a string", toStr(args[0]))})
+		}
+		return Integer(maphash.String(hashSeed, string(s)) >> 1)
+	})
+	builtin("string-ci-hash", ConsList[Atomic]("str"), func(ls *LocalScope, args []any) any {
+		s := stringOf("string-ci-hash", arity(args, 1)[0])
+		return Integer(maphash.String(hashSeed, foldString(string(s))) >> 1)
+	})
+}
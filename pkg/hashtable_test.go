@@ -0,0 +1,157 @@
+package lisp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_hash_tables(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	_, err := interp.EvalString(ctx, `
+		(define h (make-hash-table equal?))
+		(hash-table-set! h '(1 2) 'list "s" 'string 3 'three)
+		(define byLength (make-hash-table (lambda (a b) (= (strlen a) (strlen b))) (lambda (s) (strlen s))))`)
+	assert.NoError(t, err)
+
+	for _, test := range []struct{ code, expected string }{
+		{`(list (equal? '(1 (2 #t) "a") '(1 (2 #t) "a")) (eqv? '(1) '(1)) (eqv? 'a 'a) (equal? 1 2))`, `(#t #f #t #f)`},
+		{`(list (eqv? 0.0 -0.0) (eqv? +nan.0 +nan.0) (eqv? 1.5 1.5) (eqv? 1 1.0) (equal? (list 0.0) (list -0.0)))`, `(#f #t #t #f #f)`},
+		{`(list (equal? '` + "`" + `(a ,b ,@c) '` + "`" + `(a ,b ,@c)) (equal? '` + "`" + `a '(quasiquote a)) (equal? ',a ',b) (equal? ',@(x) '(unquote-splicing (x))))`, `(#t #t #f #t)`},
+		{`(define q (make-hash-table equal?)) (hash-table-set! q '` + "`" + `(a ,b) 1 +nan.0 2) (list (hash-table-ref q '(quasiquote (a (unquote b)))) (hash-table-ref q +nan.0))`, `(1 2)`},
+		{`(define e (make-hash-table eqv?)) (hash-table-set! e +nan.0 1 0.0 2 -0.0 3) (list (hash-table-ref e +nan.0) (hash-table-ref e 0.0) (hash-table-count e))`, `(1 2 3)`},
+		{`(list (hash-table-ref h (list 1 2)) (hash-table-ref/default h "s" #f) (hash-table-ref/default h 4 'none))`, `(list string none)`},
+		{`(hash-table-ref h 4 (lambda () 'missing))`, `missing`},
+		{`(hash-table-ref h 3 (lambda () 'missing) (lambda (v) (list v)))`, `(three)`},
+		{`(hash-table-update!/default h 'n (lambda (v) (+ v 1)) 10) (hash-table-ref h 'n)`, `11`},
+		{`(hash-table-update! h 'n (lambda (v) (* v 2))) (hash-table-ref h 'n)`, `22`},
+		{`(hash-table->alist h)`, `(((1 2) . list) ("s" . string) (3 . three) (n . 22))`},
+		{`(hash-table-delete! h 3 'nope) (hash-table-keys h)`, `((1 2) "s" n)`},
+		{`(hash-table-fold (lambda (k v acc) (cons v acc)) '() h)`, `(22 string list)`},
+		{`(hash-table-fold h (lambda (k v acc) (+ acc 1)) 0)`, `3`},
+		{`(define n 0) (hash-table-walk h (lambda (k v) (set! n (+ n 1)))) n`, `3`},
+		{`(hash-table-count (alist->hash-table '((a . 1) (b . 2) (a . 3)) eq?))`, `2`},
+		{`(hash-table-ref (alist->hash-table '((a . 1) (a . 3)) eq?) 'a)`, `1`},
+		{`(hash-table-set! byLength "abc" 1) (hash-table-ref/default byLength "xyz" 0)`, `1`},
+		{`(list (hash-table? h) (hash-table? '()) (hash-table-contains? h "s"))`, `(#t #f #t)`},
+		{`(let ((c (hash-table-copy h))) (hash-table-clear! c) (list (hash-table-count c) (hash-table-count h)))`, `(0 3)`},
+		{`(= (hash '(1 "a")) (hash (list 1 "a")))`, `#t`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	_, err = interp.EvalString(ctx, `(hash-table-ref h 'absent)`)
+	assert.ErrorContains(t, err, "hash-table-ref: no value for the key")
+	_, err = interp.EvalString(ctx, `(hash-table-set! 1 2 3)`)
+	assert.ErrorAs(t, err, new(TypeError))
+
+	h := FromGo(ParseJSONString(`{"b": [1, 2], "a": {"c": true}}`)).(*HashTable)
+	assert.Equal(t, `#<hash-table ("a" . #<hash-table ("c" . #t)>) ("b" 1.0 2.0)>`, toStr(h))
+	back, err := ToGo[map[string]any](h)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"a": map[string]any{"c": true}, "b": []any{1.0, 2.0}}, back)
+
+	shared := NewConcurrentHashTable(EqvComparator)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				shared.Set(Integer(i*100+j), True)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 800, shared.Len())
+}
+
+func Test_equal_circular(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	for _, test := range []struct{ code, expected string }{
+		{`(define v (vector 1 2)) (vector-set! v 0 v) (equal? v v)`, `#t`},
+		{`(define w (vector 1 2)) (vector-set! w 0 w) (equal? v w)`, `#t`},
+		{`(define u (vector 1 3)) (vector-set! u 0 u) (equal? v u)`, `#f`},
+		{`(define ww (vector (vector w 2) 2)) (equal? v ww)`, `#t`},
+		{`(define h (make-hash-table equal?)) (hash-table-set! h v 'cyclic) (hash-table-ref h w)`, `cyclic`},
+		{`(= (hash v) (hash w))`, `#t`},
+		{`(define ci (make-hash-table string-ci=?)) (hash-table-set! ci "Hello" 2) (hash-table-ref ci "hELLO")`, `2`},
+		{`(hash-table-set! ci "Straße" 3) (list (hash-table-ref ci "STRASSE") (= (string-ci-hash "Straße") (string-ci-hash "STRASSE")))`, `(3 #t)`},
+		{`(= (string-ci-hash "ABC") (string-ci-hash "abc"))`, `#t`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	// (1 2 1 2 ...) and (1 2 1 2 1 2 ...) built with different periods
+	cycle := func(n int, elems ...any) *ConsCell {
+		var all []any
+		for i := 0; i < n; i++ {
+			all = append(all, elems...)
+		}
+		l := ConsList(all...)
+		last := l
+		for !IsEmptyList(last.cdr) {
+			last = last.cdr.(*ConsCell)
+		}
+		last.SetCdr(l)
+		return l
+	}
+	assert.True(t, Equal(cycle(1, Integer(1), Integer(2)), cycle(3, Integer(1), Integer(2))))
+	assert.False(t, Equal(cycle(1, Integer(1), Integer(2)), cycle(1, Integer(1), Integer(3))))
+	big := cycle(1000, Integer(1))
+	assert.True(t, Equal(big, cycle(7, Integer(1))))
+
+	// the pairs of positions to go through are as many as the lcm of the periods
+	interp.Global().Set("c1", cycle(5000, Integer(1), Integer(2)))
+	interp.Global().Set("c2", cycle(4999, Integer(1), Integer(2)))
+	deadline, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err := interp.EvalString(deadline, `(equal? c1 c2)`)
+	assert.ErrorAs(t, err, new(InterruptError))
+}
+
+func Test_hash_table_procedures(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+
+	// the procedures of the comparator can use their own table, they run without its lock
+	res, err := interp.EvalString(ctx, `
+		(define t #f)
+		(set! t (make-concurrent-hash-table (lambda (a b) (hash-table-count t) (equal? a b)) (lambda (k) 1)))
+		(hash-table-set! t 1 1 2 2 1 3)
+		(hash-table-delete! t 2)
+		(list (hash-table->alist t) (hash-table-ref/default (hash-table-copy t) 1 #f))`)
+	assert.NoError(t, err)
+	assert.Equal(t, `(((1 . 3)) 3)`, toStr(res))
+
+	// and in the evaluation calling the table, under its deadline and its limits
+	interp.EvalString(ctx, `(define spinning (make-hash-table (lambda (a b) (let loop () (loop))) (lambda (k) 1)))
+		(hash-table-set! spinning 1 1)`)
+	deadline, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := interp.EvalString(deadline, `(hash-table-set! spinning 2 2)`)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.ErrorAs(t, err, new(InterruptError))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the equality of the table is not interrupted")
+	}
+
+	limited := New(WithLimits(Limits{MaxSteps: 10000}))
+	_, err = limited.EvalString(ctx, `(define h (make-hash-table (lambda (a b) (let loop () (loop))) (lambda (k) 1)))
+		(hash-table-set! h 1 1 2 2)`)
+	assert.ErrorAs(t, err, new(LimitError))
+}
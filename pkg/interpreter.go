@@ -0,0 +1,156 @@
+package lisp
+
+import (
+	"context"
+	"golisp/lib"
+	"golisp/parsing"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+)
+
+// Interpreter is an independent instance of the language:
+// its own global environment, gensym counter and standard ports
+type Interpreter struct {
+	global *LocalScope
+	symCnt atomic.Int64
+
+	aliasCnt atomic.Int64 // the fresh numbers of the aliases and of their macro environments
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	inPort, outPort, errPort *Port // over the standard streams
+
+	stdlib   bool
+	limits   Limits
+	builtins []Atomic
+	sealed   bool // the global environment is a sandbox
+}
+
+type Option func(*Interpreter)
+
+func WithStdin(r io.Reader) Option  { return func(it *Interpreter) { it.stdin = r } }
+func WithStdout(w io.Writer) Option { return func(it *Interpreter) { it.stdout = w } }
+func WithStderr(w io.Writer) Option { return func(it *Interpreter) { it.stderr = w } }
+
+// only the builtins, lib/src/*.scm is not loaded
+func WithoutStdlib() Option { return func(it *Interpreter) { it.stdlib = false } }
+
+var (
+	// Default is the interpreter behind Global, it has no standard library loaded
+	Default *Interpreter
+	// Global is the global scope of Default, kept for compatibility
+	Global *LocalScope
+)
+
+func init() {
+	Default = New(WithoutStdlib())
+	Global = Default.Global()
+}
+
+func New(opts ...Option) *Interpreter {
+	it := &Interpreter{stdlib: true}
+	for _, opt := range opts {
+		opt(it)
+	}
+
+	it.inPort = NewInputPort("stdin", it.Stdin())
+	it.outPort = NewOutputPort("stdout", it.Stdout())
+	it.errPort = NewOutputPort("stderr", it.Stderr())
+
+	it.global = NewScope()
+	it.global.interp = it
+	RegisterBasicForms(it.global)
+	registerMacros(it.global)
+	registerConditions(it.global)
+	registerForeign(it.global)
+	registerSyntax(it.global)
+	registerRecords(it.global)
+	registerHashTables(it.global)
+	registerVectors(it.global)
+	registerChars(it.global)
+	registerStrings(it.global)
+	registerRegexps(it.global)
+	registerPorts(it.global)
+
+	if it.stdlib {
+		if err := it.loadStdlib(); err != nil {
+			panic(err) // it is embedded, so it is a bug
+		}
+	}
+	if it.builtins != nil {
+		it.global = sandbox(it, it.global)
+		it.sealed = true
+	}
+	return it
+}
+
+func (it *Interpreter) Global() *LocalScope { return it.global }
+
+// standard ports, os ones unless set by options
+func (it *Interpreter) Stdin() io.Reader {
+	if it.stdin == nil {
+		return os.Stdin
+	}
+	return it.stdin
+}
+
+func (it *Interpreter) Stdout() io.Writer {
+	if it.stdout == nil {
+		return os.Stdout
+	}
+	return it.stdout
+}
+
+func (it *Interpreter) Stderr() io.Writer {
+	if it.stderr == nil {
+		return os.Stderr
+	}
+	return it.stderr
+}
+
+// SetStdin, SetStdout and SetStderr replace the standard ports of the interpreter,
+// evaluations already running may keep using the old ones
+func (it *Interpreter) SetStdin(r io.Reader) {
+	it.stdin = r
+	it.inPort = NewInputPort("stdin", it.Stdin())
+}
+
+func (it *Interpreter) SetStdout(w io.Writer) {
+	it.stdout = w
+	it.outPort = NewOutputPort("stdout", it.Stdout())
+}
+
+func (it *Interpreter) SetStderr(w io.Writer) {
+	it.stderr = w
+	it.errPort = NewOutputPort("stderr", it.Stderr())
+}
+
+func (it *Interpreter) GenSym(prefix string) Atomic {
+	if prefix == "" {
+		prefix = "_"
+	}
+	return Atomic(prefix + strconv.FormatInt(it.symCnt.Add(1)-1, 10))
+}
+
+func (it *Interpreter) loadStdlib() error {
+	return fs.WalkDir(lib.StandardLibrary, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(name) != ".scm" {
+			return nil
+		}
+		src, err := fs.ReadFile(lib.StandardLibrary, name)
+		if err != nil {
+			return err
+		}
+		_, err = it.evalSource(context.Background(), parsing.NewStringSource(string(src)).Named(name), nil)
+		return err
+	})
+}
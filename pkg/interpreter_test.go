@@ -0,0 +1,36 @@
+package lisp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_interpreters_isolated(t *testing.T) {
+	var out1, out2 bytes.Buffer
+	a, b := New(WithStdout(&out1)), New(WithStdout(&out2), WithoutStdlib())
+
+	ParseSExpString(`(define x 1)`).Exec(a.Global())
+	ParseSExpString(`(define x 2)`).Exec(b.Global())
+	assert.Equal(t, Integer(1), ParseSExpString(`x`).Exec(a.Global()))
+	assert.Equal(t, Integer(2), ParseSExpString(`x`).Exec(b.Global()))
+	_, defined := Global.Get("x")
+	assert.False(t, defined)
+
+	assert.Equal(t, Atomic("sym0"), ParseSExpString(`(gensym)`).Exec(a.Global()))
+	assert.Equal(t, Atomic("sym1"), ParseSExpString(`(gensym)`).Exec(a.Global()))
+	assert.Equal(t, Atomic("sym0"), ParseSExpString(`(gensym)`).Exec(b.Global()))
+
+	ParseSExpString(`(println "to a")`).Exec(a.Global())
+	ParseSExpString(`(println "to b")`).Exec(b.Global())
+	assert.Equal(t, "to a\n", out1.String())
+	assert.Equal(t, "to b\n", out2.String())
+}
+
+func Test_interpreter_stdlib(t *testing.T) {
+	withLib, bare := New(), New(WithoutStdlib())
+	assert.Equal(t, Integer(3), ParseSExpString(`(length '(1 2 3))`).Exec(withLib.Global()))
+	_, defined := bare.Global().Get("length")
+	assert.False(t, defined)
+}
@@ -0,0 +1,176 @@
+package lisp
+
+import "fmt"
+
+// Limits bound the resources of one evaluation: a call of EvalString,
+// EvalReader, LoadFile or Call (or Expr.Eval). Zero means unlimited.
+type Limits struct {
+	MaxSteps       int64 // procedure and special form calls
+	MaxDepth       int   // nested evaluations on the Go stack, DefaultMaxDepth if zero
+	MaxConses      int64 // cons cells allocated, argument lists included
+	MaxStringBytes int64 // bytes of strings and big exact powers created by builtins
+}
+
+// DefaultMaxDepth keeps deep non-tail recursion far from the Go stack limit,
+// which is a fatal error and can not be recovered from
+const DefaultMaxDepth = 100000
+
+// LimitError is the failure of an evaluation exceeding one of its Limits
+type LimitError struct {
+	Limit string
+	Max   int64
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("limit exceeded: %s (max %d)", e.Limit, e.Max)
+}
+func (e LimitError) Message() string    { return "limit exceeded: " + e.Limit }
+func (LimitError) Irritants() *ConsCell { return nil }
+
+// resources used by an evaluation so far
+type quota struct {
+	Limits
+	steps, conses, bytes int64
+}
+
+func (it *Interpreter) newQuota() *quota {
+	q := &quota{Limits: it.limits}
+	if q.MaxDepth == 0 {
+		q.MaxDepth = DefaultMaxDepth
+	}
+	return q
+}
+
+func (q *quota) step() {
+	if q != nil && q.MaxSteps > 0 {
+		if q.steps++; q.steps > q.MaxSteps {
+			panic(LimitError{"steps", q.MaxSteps})
+		}
+	}
+}
+
+func (q *quota) nest(depth int) {
+	if q != nil && q.MaxDepth > 0 && depth > q.MaxDepth {
+		panic(LimitError{"call depth", int64(q.MaxDepth)})
+	}
+}
+
+func (q *quota) allocate(conses, bytes int) {
+	if q == nil {
+		return
+	}
+	q.conses += int64(conses)
+	q.bytes += int64(bytes)
+	if q.MaxConses > 0 && q.conses > q.MaxConses {
+		panic(LimitError{"cons cells", q.MaxConses})
+	}
+	if q.MaxStringBytes > 0 && q.bytes > q.MaxStringBytes {
+		panic(LimitError{"string bytes", q.MaxStringBytes})
+	}
+}
+
+// accounts cons cells and string bytes created by a builtin
+func (l *LocalScope) allocate(conses, bytes int) {
+	if th := l.dyn.currentThread(); th != nil {
+		th.quota.allocate(conses, bytes)
+	}
+}
+
+func WithLimits(limits Limits) Option { return func(it *Interpreter) { it.limits = limits } }
+
+// WithBuiltins makes a sandbox: the global environment has only the named
+// bindings (of the builtins and the standard library, unknown names are skipped)
+// and the code can not define or set! its variables. The standard library
+// keeps working, its procedures see the full environment.
+func WithBuiltins(names ...Atomic) Option {
+	return func(it *Interpreter) { it.builtins = names }
+}
+
+// SafeBuiltins have no access to the host: no eval, no I/O. The global environment of
+// the sandbox is read-only, so define and define-syntax bind in local scopes only,
+// where macros of syntax-rules are allowed as with let-syntax.
+var SafeBuiltins = []Atomic{
+	"true", "false", "quote", "quasiquote", "unquote", "unquote-splicing",
+	"lambda", "define", "set!", "if", "apply", "gensym", "defined?", "version",
+	"define-syntax", "let-syntax", "letrec-syntax", "syntax-rules",
+	"define-record-type", "record?", "set-record-type-printer!",
+	"eqv?", "equal?", "hash", "string-hash", "string-ci-hash", "make-hash-table", "make-concurrent-hash-table",
+	"alist->hash-table", "hash-table?", "hash-table-ref", "hash-table-ref/default",
+	"hash-table-contains?", "hash-table-set!", "hash-table-delete!", "hash-table-update!",
+	"hash-table-update!/default", "hash-table-count", "hash-table-size", "hash-table-keys",
+	"hash-table-values", "hash-table->alist", "hash-table-walk", "hash-table-fold",
+	"hash-table-copy", "hash-table-clear!",
+	"vector?", "vector", "make-vector", "vector-length", "vector-ref", "vector-set!",
+	"vector-fill!", "vector-copy", "vector-append", "vector->list", "list->vector",
+	"vector-map", "vector-for-each",
+	"char?", "char->integer", "integer->char", "char=?", "char<?", "char>?", "char<=?", "char>=?",
+	"char-ci=?", "char-ci<?", "char-ci>?", "char-ci<=?", "char-ci>=?", "char-alphabetic?",
+	"char-numeric?", "char-whitespace?", "char-upper-case?", "char-lower-case?", "char-upcase",
+	"char-downcase", "char-foldcase", "digit-value", "string-ref",
+	"string?", "string-length", "string", "make-string", "substring", "string-copy", "string-append",
+	"string-upcase", "string-downcase", "string-foldcase", "string=?", "string<?", "string>?",
+	"string<=?", "string>=?", "string-ci=?", "string-ci<?", "string-ci>?", "string-ci<=?",
+	"string-ci>=?", "string-index", "string-contains", "string-split", "string-join", "string-trim",
+	"string-trim-left", "string-trim-right", "string-pad", "string-pad-right", "string-replace",
+	"string->list", "list->string", "string->symbol", "symbol->string",
+	"regexp", "regexp?", "regexp-match", "regexp-match-all", "regexp-search", "regexp-replace",
+	"regexp-replace-all", "regexp-split", "write-to-string",
+	"car", "cdr", "cons", "atom?", "symbol?", "null?", "eq?", "strlen", "char",
+	"+", "-", "*", "/", "=", "<", ">", "<=", ">=",
+	"number?", "real?", "rational?", "integer?", "exact-integer?", "exact?", "inexact?",
+	"exact", "inexact", "quotient", "remainder", "modulo", "numerator", "denominator", "gcd", "lcm",
+	"number->string", "string->number",
+	"floor", "ceiling", "truncate", "round", "abs", "square", "sqrt", "exact-integer-sqrt", "expt",
+	"exp", "log", "sin", "cos", "tan", "asin", "acos", "atan", "min", "max", "floor/", "truncate/",
+	"make-random-source", "random-integer", "random-real",
+	"call/cc", "call-with-current-continuation", "dynamic-wind",
+	"error", "raise", "raise-continuable", "with-exception-handler", "guard",
+	"error-object-message", "error-object-irritants", "error-object?",
+	"unbound-variable-error?", "syntax-error?", "read-error?", "type-error?",
+	"arity-error?", "interrupted-error?", "limit-error?",
+
+	// lib/src
+	"atom", "nil", "nil?", "zero?", "not", "pair?", "1+", "1-", "else",
+	"list", "length", "reverse", "flatten", "append", "foldl", "foldr",
+	"reduce", "reducer", "const", "nth", "some?", "map", "member",
+	"begin", "when", "unless", "nif", "let", "let*", "let**", "letrec",
+	"or", "and", "cond", "case", "bind-lists", "make-promise", "delay", "force",
+	"caar", "cadr", "cdar", "cddr", "caaar", "caadr", "cadar", "caddr",
+	"cdaar", "cdadr", "cddar", "cdddr", "caaaar", "caaadr", "caadar", "caaddr",
+	"cadaar", "cadadr", "caddar", "cadddr", "cdaaar", "cdaadr", "cdadar",
+	"cdaddr", "cddaar", "cddadr", "cdddar", "cddddr",
+}
+
+// the global environment of a sandbox with the whitelisted bindings of full
+func sandbox(it *Interpreter, full *LocalScope) *LocalScope {
+	global := NewScope()
+	global.interp = it
+	// the aliases of the library macros are looked up in the sandbox, in the whitelist only
+	global.mu.macroID.Store(int64(macroEnvID(full)))
+	for _, name := range it.builtins {
+		if v, ok := full.Get(name); ok {
+			global.Set(name, v)
+		}
+	}
+	return global
+}
+
+// fails on changing a top-level binding of a sandbox
+func (l *LocalScope) checkWritable(form string, name Atomic) {
+	if it := l.interp; l.parent == nil && it != nil && it.sealed && l.mu == it.global.mu {
+		panic(ExecError{fmt.Sprintf("%s: the global environment is read-only, can not bind '%s'", form, name)})
+	}
+}
+
+// the scope holding the binding of name
+func (l *LocalScope) holder(name Atomic) *LocalScope {
+	for ; l != nil; l = l.parent {
+		l.mu.RLock()
+		_, found := l.defs[name]
+		l.mu.RUnlock()
+		if found {
+			return l
+		}
+	}
+	return nil
+}
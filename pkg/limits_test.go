@@ -0,0 +1,76 @@
+package lisp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Limits(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		limits Limits
+		code   string
+		limit  string
+	}{
+		{Limits{MaxSteps: 10000}, `(define (spin) (spin)) (spin)`, "steps"},
+		{Limits{MaxDepth: 500}, `(deep 1000)`, "call depth"},
+		{Limits{MaxConses: 1000}, `(define (grow l) (grow (cons 1 l))) (grow '())`, "cons cells"},
+		{Limits{MaxStringBytes: 10}, `(define (chars n) (if (= n 0) 0 (begin (number->string 123) (chars (- n 1))))) (chars 20)`, "string bytes"},
+	} {
+		interp := New(WithLimits(test.limits))
+		_, err := interp.EvalString(ctx, `(define (deep n) (if (= n 0) 0 (+ 1 (deep (- n 1)))))`)
+		assert.NoError(t, err)
+
+		var limit LimitError
+		_, err = interp.EvalString(ctx, test.code)
+		assert.ErrorAs(t, err, &limit, test.code)
+		assert.Equal(t, test.limit, limit.Limit)
+
+		// every evaluation has its own budget
+		for range 3 {
+			res, err := interp.EvalString(ctx, `(deep 100)`)
+			assert.NoError(t, err)
+			assert.Equal(t, Integer(100), res)
+		}
+	}
+
+	interp := New(WithLimits(Limits{MaxDepth: 500}))
+	res, err := interp.EvalString(ctx, `
+		(define (deep n) (if (= n 0) 0 (+ 1 (deep (- n 1)))))
+		(guard (e ((limit-error? e) 'caught)) (deep 1000))`)
+	assert.NoError(t, err)
+	assert.Equal(t, Atomic("caught"), res)
+}
+
+func Test_Sandbox(t *testing.T) {
+	ctx := context.Background()
+	interp := New(WithBuiltins(SafeBuiltins...))
+
+	res, err := interp.EvalString(ctx, `
+		(let ((sq (lambda (x) (* x x))))
+			(define (inner) (map sq (list 1 2 3)))
+			(inner))`)
+	assert.NoError(t, err)
+	assert.Equal(t, "(1 4 9)", toStr(res))
+
+	for _, code := range []string{`(eval '(+ 1 2))`, `(display 1)`, `(_len '(1) 0)`} {
+		_, err := interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(UnboundError), code)
+	}
+
+	res, err = interp.EvalString(ctx, `
+		(let ()
+			(define-syntax twice (syntax-rules () ((_ e) (list e e))))
+			(let-syntax ((one (syntax-rules () ((_) 1)))) (twice (one))))`)
+	assert.NoError(t, err)
+	assert.Equal(t, "(1 1)", toStr(res))
+
+	for _, code := range []string{`(define x 1)`, `(define (f) 1)`, `(set! car cdr)`, `(define-syntax m (syntax-rules () ((_) 1)))`} {
+		_, err := interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(ExecError), code)
+	}
+	res, _ = interp.EvalString(ctx, `(car '(1 2))`)
+	assert.Equal(t, Integer(1), res)
+}
@@ -1,7 +1,12 @@
 package lisp
 
 import (
+	"context"
+	"runtime"
+	"sync"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_macro(t *testing.T) {
@@ -9,3 +14,194 @@ func Test_macro(t *testing.T) {
 		_ = test
 	}
 }
+
+func Test_syntax_rules(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	_, err := interp.EvalString(ctx, `
+		(define-syntax swap!
+			(syntax-rules ()
+				((_ a b) (let ((tmp a)) (set! a b) (set! b tmp)))))
+		(define-syntax my-let*
+			(syntax-rules ()
+				((_ () body ...) (let () body ...))
+				((_ ((x v) rest ...) body ...) (let ((x v)) (my-let* (rest ...) body ...)))))
+		(define-syntax flat
+			(syntax-rules ()
+				((_ (a b ...) ...) '((a ...) (b ... ...)))))
+		(define-syntax rotate
+			(syntax-rules ()
+				((_ a ... . r) '(r a ...))))
+		(define-syntax def-begin
+			(syntax-rules ()
+				((_ name) (define-syntax name (syntax-rules () ((name e (... ...)) (begin e (... ...))))))))
+		(def-begin sequence)
+		(define-syntax while
+			(syntax-rules etc (do)
+				((_ c do body etc) (let loop () (when c body etc (loop))))))`)
+	assert.NoError(t, err)
+
+	for _, test := range []struct{ code, expected string }{
+		{`(define tmp 1) (define y 2) (swap! tmp y) (list tmp y)`, `(2 1)`},
+		{`(define h 5) (or #f h)`, `5`},
+		{`(let ((if list)) (or #f 3))`, `3`},
+		{`(my-let* ((a 1) (b (+ a 1))) (* a b))`, `2`},
+		{`(flat (1 2 3) (4 5))`, `((1 4) (2 3 5))`},
+		{`(rotate 1 2 . 3)`, `(3 1 2)`},
+		{`(sequence 1 2 3)`, `3`},
+		{`(define i 0) (while (< i 5) do (set! i (+ i 1))) i`, `5`},
+		{`(let-syntax ((double (syntax-rules () ((_ x) (* x 2))))) (double 21))`, `42`},
+		{`(letrec-syntax
+			((ev? (syntax-rules () ((_ n) (if (= n 0) #t (od? (- n 1))))))
+			 (od? (syntax-rules () ((_ n) (if (= n 0) #f #t)))))
+			(ev? 2))`, `#t`},
+		{`(let loop ((i 0) (acc '())) (if (= i 3) acc (loop (+ i 1) (cons i acc))))`, `(2 1 0)`},
+		{`(cond ((car '(2 3)) => (lambda (x) (* x 10))) (else 0))`, `20`},
+		{`(cond (#f 1) ((+ 1 2)))`, `3`},
+		{`(case (* 2 3) ((2 3 5 7) 'prime) ((1 4 6 8 9) 'composite))`, `composite`},
+		{`(case 'x ((a) 1) (else => (lambda (k) k)))`, `x`},
+		{`(list (and 1 2) (and) (and 1 #f 3) (or) (or #f #f))`, `(2 #t #f #f #f)`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	_, err = interp.EvalString(ctx, `(swap! 1)`)
+	assert.ErrorAs(t, err, new(SyntaxError))
+	assert.ErrorContains(t, err, "no syntax rule matches (swap! 1)")
+}
+
+func Test_syntax_rules_aliases(t *testing.T) {
+	ctx := context.Background()
+	a, b := New(), New()
+	for _, it := range []*Interpreter{a, b} {
+		_, err := it.EvalString(ctx, `
+			(define-syntax inc! (syntax-rules () ((_ x) (let ((tmp x)) (set! x (+ tmp step))))))
+			(define v 0)`)
+		assert.NoError(t, err)
+	}
+	_, err := a.EvalString(ctx, `(define step 1)`)
+	assert.NoError(t, err)
+	_, err = b.EvalString(ctx, `(define step 10)`)
+	assert.NoError(t, err)
+
+	res, err := a.EvalString(ctx, `(let loop ((i 0)) (when (< i 100) (eval '(inc! v)) (loop (+ i 1)))) v`)
+	assert.NoError(t, err)
+	assert.Equal(t, Integer(100), res)
+	res, err = b.EvalString(ctx, `(inc! v) v`)
+	assert.NoError(t, err)
+	assert.Equal(t, Integer(10), res)
+	assert.Equal(t, Atomic("tmp"), stripAlias("tmp·1.2·3.4"))
+	assert.Equal(t, Atomic("a·b"), stripAlias("a·b"))
+
+	// the aliases find the scope of the call defining the macro, the scopes of the calls are not kept
+	res, err = a.EvalString(ctx, `
+		(define (make n) (let-syntax ((get (syntax-rules () ((_) n)))) (lambda () (get))))
+		(define (f) (let-syntax ((m (syntax-rules () ((_) (list 1 2))))) (m)))
+		(define (calls n) (when (> n 0) (f) (calls (- n 1))))
+		(list ((make 5)) ((make 6)) (f))`)
+	assert.NoError(t, err)
+	assert.Equal(t, `(5 6 (1 2))`, toStr(res))
+	heap := func() uint64 {
+		var m runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&m)
+		return m.HeapAlloc
+	}
+	_, err = a.EvalString(ctx, `(calls 20000)`)
+	assert.NoError(t, err)
+	before := heap()
+	_, err = a.EvalString(ctx, `(calls 20000)`)
+	assert.NoError(t, err)
+	assert.Less(t, heap(), before+1<<20)
+	runtime.KeepAlive(a)
+}
+
+func Test_macroexpand(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	_, err := interp.EvalString(ctx, `
+		(define expansions 0)
+		(defmacro counted (x) (set! expansions (+ expansions 1)) x)
+		(define (f) (counted 1))
+		(define-syntax my-if
+			(syntax-rules ()
+				((_ c a b) (cond (c a) (else b)))))`)
+	assert.NoError(t, err)
+
+	for _, test := range []struct{ code, expected string }{
+		{`(f) (f) (f) expansions`, `1`},
+		{`(macroexpand-1 '(counted (+ 1 2)))`, `(+ 1 2)`},
+		{`(macroexpand-1 '(+ 1 2))`, `(+ 1 2)`},
+		{`(macroexpand '(counted (counted 3)))`, `3`},
+		{`(macroexpand-all '(list (counted (counted 3)) '(counted 4)))`, `(list 3 (quote (counted 4)))`},
+		{`(macroexpand-all '(lambda (counted) (counted 5)))`, `(lambda (counted) 5)`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	res, err := interp.EvalString(ctx, `(macroexpand-1 '(my-if #t 1 2))`)
+	assert.NoError(t, err)
+	assert.Equal(t, Atomic("cond"), stripAlias(res.(*ConsCell).Car().(Atomic)))
+}
+
+func Test_expansion_memo(t *testing.T) {
+	ctx := context.Background()
+	a, b := New(), New()
+	for _, it := range []*Interpreter{a, b} {
+		_, err := it.EvalString(ctx, `(define-syntax twice (syntax-rules () ((_ e) (let ((x e)) (+ x x)))))`)
+		assert.NoError(t, err)
+	}
+
+	form := ParseSExpString(`(twice 21)`) // shared by the interpreters
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		it := []*Interpreter{a, b}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := form.Eval(it.Global())
+			assert.NoError(t, err)
+			assert.Equal(t, Integer(42), res)
+		}()
+	}
+	wg.Wait()
+
+	res, err := form.Eval(b.Global())
+	assert.NoError(t, err)
+	assert.Equal(t, Integer(42), res)
+	assert.Same(t, b, form.sexp.exp.Load().it)
+}
+
+func Test_quasiquote(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	_, err := interp.EvalString(ctx, `(define x 1) (define b '(2 3))`)
+	assert.NoError(t, err)
+
+	for _, test := range []struct{ code, expected string }{
+		{"`(a `(b ,(c ,x)))", "(a `(b ,(c 1)))"},
+		{"`(1 `,(+ 1 ,x))", "(1 `,(+ 1 1))"},
+		{"`(a . ,b)", "(a 2 3)"},
+		{"`(a unquote b)", "(a 2 3)"},
+		{"`(1 ,@b ,@b)", "(1 2 3 2 3)"},
+		{"(quasiquote (a (unquote x) (unquote-splicing b) 4))", "(a 1 2 3 4)"},
+		{"(let ((l '(1 2))) (eq? (cdr `(0 ,@l 3)) l))", "#f"},
+		{"(let ((l '(1 2))) (eq? (cdr `(0 ,@l)) l))", "#t"},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	vec := Quasiquote(NewArray(Atomic("a"), Unquoted{Atomic("x")}, UnquotedSpliced{Atomic("b")}))
+	assert.Equal(t, "#(a 1 2 3)", toStr(vec.Substitute(interp.Global())))
+
+	for _, code := range []string{",x", "`,@b", "(unquote x)"} {
+		_, err := interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(ExecError), code)
+	}
+}
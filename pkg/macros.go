@@ -1,13 +1,5 @@
 package lisp
 
-import (
-	"fmt"
-)
-
-func init() {
-	registerMacros(Global)
-}
-
 type (
 	Quasiquoted     struct{ boxed any }
 	Unquoted        struct{ boxed any }
@@ -18,60 +10,150 @@ func (u Unquoted) String() string        { return "," + toStr(u.boxed) } // or (
 func (u UnquotedSpliced) String() string { return ",@" + toStr(u.boxed) }
 func (q Quasiquoted) String() string     { return "`" + toStr(q.boxed) }
 
+// abbreviation is `x ,x or ,@x as read, the datum is the list (quasiquote x) and so on
+type abbreviation interface {
+	prefix() string
+	name() Atomic
+	datum() any
+	with(datum any) abbreviation // the same abbreviation of another datum
+}
+
+func (q Quasiquoted) prefix() string     { return "`" }
+func (u Unquoted) prefix() string        { return "," }
+func (u UnquotedSpliced) prefix() string { return ",@" }
+
+func (q Quasiquoted) name() Atomic     { return "quasiquote" }
+func (u Unquoted) name() Atomic        { return "unquote" }
+func (u UnquotedSpliced) name() Atomic { return "unquote-splicing" }
+
+func (q Quasiquoted) datum() any     { return q.boxed }
+func (u Unquoted) datum() any        { return u.boxed }
+func (u UnquotedSpliced) datum() any { return u.boxed }
+
+func (q Quasiquoted) with(v any) abbreviation     { return Quasiquoted{v} }
+func (u Unquoted) with(v any) abbreviation        { return Unquoted{v} }
+func (u UnquotedSpliced) with(v any) abbreviation { return UnquotedSpliced{v} }
+
 func (q Quasiquoted) Exec(ctx *LocalScope) any {
 	return q.Substitute(ctx)
 }
 
-func checkQuasi(ctx *LocalScope) {
-	if val, ok := ctx.Get("$quasi"); !ok || !val.(bool) {
-		panic(ExecError{"unquote out of quasiquote expression"})
-	}
+// unquotes are only evaluated by the quasiquote expander
+func (a Unquoted) Exec(*LocalScope) any {
+	panic(ExecError{"unquote out of quasiquote expression"})
 }
 
-func (a Unquoted) Exec(ctx *LocalScope) any {
-	checkQuasi(ctx)
-	ctx.Set("$quasi", false)
-	defer ctx.Set("$quasi", true)
-	res := ExprOfAny(a.boxed).Exec(ctx)
-	// for, for instance: `(x y z ... ,a ,b); so ,b is correct, but if we set $quasi to false in ,a it fails
-	return res
+func (a UnquotedSpliced) Exec(*LocalScope) any {
+	panic(ExecError{"unquote-splicing out of quasiquote expression"})
 }
 
-func (a UnquotedSpliced) Exec(ctx *LocalScope) any {
-	return Unquoted(a).Exec(ctx)
+// Substitute builds the quasiquoted structure, only the parts unquoted at
+// the nesting level of this quasiquote are evaluated
+func (q Quasiquoted) Substitute(ctx *LocalScope) any {
+	return quasi(ctx, q.boxed, 1)
 }
 
-func (s Expr) Substitute(ctx *LocalScope) any {
-	if s.isSExpr {
-		return MapConsUnfold(func(a any) (any, bool) { // q.boxed:(x y z ... ,a ...)
-			// fmt.Printf("map : %20s %s\n", TypeOf(a), a)
-			switch t := a.(type) {
-			case Unquoted:
-				return t.Exec(ctx), false
-			case UnquotedSpliced:
-				// << map .exec(ctx) t.boxed >>
-				return t.Exec(ctx), true
-			default:
-				return ExprOfAny(t).Substitute(ctx), false
+// the template at the nesting level depth, 0 would be out of any quasiquote
+func quasi(ctx *LocalScope, tmpl any, depth int) any {
+	switch t := tmpl.(type) {
+	case Unquoted:
+		if depth == 1 {
+			return ExprOfAny(t.boxed).Exec(ctx)
+		}
+		return Unquoted{quasi(ctx, t.boxed, depth-1)}
+	case UnquotedSpliced:
+		if depth == 1 {
+			panic(ExecError{"unquote-splicing out of list"})
+		}
+		return UnquotedSpliced{quasi(ctx, t.boxed, depth-1)}
+	case Quasiquoted:
+		return Quasiquoted{quasi(ctx, t.boxed, depth+1)}
+	case *ConsCell:
+		if t == nil {
+			return t
+		}
+		if arg, ok := quasiForm(t, "unquote"); ok {
+			return quasi(ctx, Unquoted{arg}, depth)
+		} else if arg, ok := quasiForm(t, "unquote-splicing"); ok {
+			return quasi(ctx, UnquotedSpliced{arg}, depth)
+		} else if arg, ok := quasiForm(t, "quasiquote"); ok {
+			return quasi(ctx, Quasiquoted{arg}, depth)
+		}
+		return quasiList(ctx, t, depth)
+	case *Array:
+		var elems []any
+		for v := quasiList(ctx, ConsList(t.storage...), depth); !IsEmptyList(v); {
+			c, ok := v.(*ConsCell)
+			if !ok {
+				panic(ExecError{"error unpacking smth like (x y . z ...)"})
 			}
-		}, s.sexp)
-	} else if u, ok := s.atom.(Unquoted); ok {
-		return u.Exec(ctx)
-	} else {
-		return s.atom
+			elems, v = append(elems, c.car), c.cdr
+		}
+		return NewArray(elems...)
+	default:
+		return syntaxToDatum(t)
 	}
 }
 
-func (q Quasiquoted) Substitute(ctx *LocalScope) any {
-	ctx.Set("$quasi", true)
-	if u, ok := q.boxed.(Unquoted); ok {
-		return u.Exec(ctx)
-	} else {
-		return ExprOfAny(q.boxed).Substitute(ctx)
+// the argument of (name arg), which is the long form of `arg ,arg and ,@arg
+func quasiForm(v any, name Atomic) (any, bool) {
+	c, ok := v.(*ConsCell)
+	if !ok || c == nil {
+		return nil, false
+	}
+	head, ok := c.car.(Atomic)
+	if !ok || stripAlias(head) != name {
+		return nil, false
+	}
+	rest, ok := c.cdr.(*ConsCell)
+	if !ok || rest == nil || !IsEmptyList(rest.cdr) {
+		return nil, false
 	}
-	// if s, ok := q.boxed.(Expr);            ok { return s.Substitute(ctx)
-	// } else if u, ok := q.boxed.(Unquoted); ok { return ExprOfAny(u.Exec(ctx))
-	// } else { return ExprOfAny(q.boxed) }
+	return rest.car, true
+}
+
+// a fresh list, only the splice in the last position is shared: `(a ,@b) is (a . b)
+func quasiList(ctx *LocalScope, c *ConsCell, depth int) any {
+	var elems []any
+	var tail any = c
+	for {
+		cell, ok := tail.(*ConsCell)
+		if !ok || cell == nil {
+			break
+		} else if _, ok := quasiForm(cell, "unquote"); ok { // (a unquote b) is (a . ,b)
+			break
+		}
+		tail = cell.cdr
+
+		arg, ok := quasiForm(cell.car, "unquote-splicing")
+		if s, isSpliced := cell.car.(UnquotedSpliced); isSpliced {
+			arg, ok = s.boxed, true
+		}
+		if !ok || depth > 1 {
+			elems = append(elems, quasi(ctx, cell.car, depth))
+			continue
+		}
+		v := ExprOfAny(arg).Exec(ctx)
+		if IsEmptyList(tail) {
+			return consAll(elems, v)
+		}
+		for !IsEmptyList(v) {
+			c, ok := v.(*ConsCell)
+			if !ok {
+				panic(ExecError{"error unpacking smth like (x y . z ...)"})
+			}
+			elems, v = append(elems, c.car), c.cdr
+		}
+	}
+	return consAll(elems, quasi(ctx, tail, depth))
+}
+
+// (elems... . tail)
+func consAll(elems []any, tail any) any {
+	for i := len(elems) - 1; i >= 0; i-- {
+		tail = Cons(elems[i], tail)
+	}
+	return tail
 }
 
 func Quasiquote(subj any) Quasiquoted { // `(...) / `a  ?
@@ -87,33 +169,35 @@ func UnquoteSplicing(subj any) UnquotedSpliced { // ,@(...) / ,@a
 	return UnquotedSpliced{boxed: subj}
 }
 
-func Macroexpand(syntax Expr) any {
-	if syntax.isSExpr {
-		// fmt.Println("EXPAND", syntax)
-		panic(ExecError{"not quasiquote"})
-	} else if q, ok := syntax.atom.(Quasiquoted); ok {
-		return q.Substitute(Global)
-	} else {
-		return AnyFromExpr(syntax)
+// Macroexpand expands the form until it is not a macro call, quasiquotes are substituted
+func Macroexpand(ctx *LocalScope, syntax Expr) any {
+	if q, ok := syntax.atom.(Quasiquoted); ok && !syntax.isSExpr {
+		return q.Substitute(ctx)
+	}
+	form := AnyFromExpr(syntax)
+	for expanded := true; expanded; {
+		form, expanded = MacroexpandOnce(ctx, form)
 	}
+	return form
 }
 
 func Macro(defCtx *LocalScope, argNames Expr, es ...Expr) *Func {
-	return &Func{
+	f := &Func{
 		macro: true,
 		args:  argNames,
 		code:  es,
 		// ast traversal
-		fn: func(callCtx *LocalScope, args Pair) any { // like lambda
+		expand: func(callCtx *LocalScope, args Pair) any { // like lambda
 			newCtx := defCtx.Sub()
+			newCtx.dyn = callCtx.dyn
 			cons := args
-			// fmt.Println(argNames, "<-", args)
-			// return Macroexpand(ExprOfAny(args)).Exec(newCtx)
 
 			if argNames.isSExpr { // (lambda (a b . c) ...)
-				// fmt.Println("Branch 1")
 				var args any = argNames.sexp // maybe nil
 				for ; IsCons(args) && !IsNil(args); args, cons = args.(Pair).Cdr(), PairOf(cons.Cdr()) {
+					if IsEmptyList(cons) {
+						panic(TooFewArguments)
+					}
 					newCtx.Set(args.(Pair).Car().(Atomic), cons.Car())
 				}
 
@@ -129,30 +213,106 @@ func Macro(defCtx *LocalScope, argNames Expr, es ...Expr) *Func {
 					panic(TooManyArguments)
 				}
 			} else if argNames.atom != nil { // (lambda x ...)
-				// fmt.Println("Branch 2")
 				// argNames.atom is nil in case of (lambda () ...) or (lambda nil ...)
 				newCtx.Set(argNames.atom.(Atomic), cons)
 			}
 
-			// fmt.Println("macro exec with:") // newCtx
 			var res any
 			for _, e := range es {
-				// fmt.Println("  to execute:", e)
 				res = e.Exec(newCtx)
-				// fmt.Println("    res ->", res)
 			}
-			// fmt.Println("built")
+			return res
+		},
+	}
+	f.fn = expanding(f)
+	return f
+}
+
+// fn of a macro with expand: the expansion is evaluated in the main context immediately unlike in `lambda`
+func expanding(f *Func) func(*LocalScope, Pair) any {
+	return func(callCtx *LocalScope, args Pair) any {
+		return &tailCall{f.expand(callCtx, args), callCtx}
+	}
+}
+
+// expansions are computed once per call site, the form keeps the last one
+// with the macro and the interpreter it was made by
+type expansion struct {
+	it    *Interpreter
+	macro *Func
+	code  any
+}
+
+func (expr *ConsCell) expansion(macro *Func, ctx *LocalScope) any {
+	it := ctx.Interpreter()
+	if e := expr.exp.Load(); e != nil && e.macro == macro && e.it == it {
+		return e.code
+	}
+	code := macro.expand(ctx, PairOf(expr.cdr))
+	expr.exp.Store(&expansion{it, macro, code})
+	return code
+}
 
-			if exec, ok := res.(Executor); ok {
-				return exec.Exec(callCtx) // not newCtx because we should evaluate syntax changes in thw main context immediately unlike in `lambda`
-			} else {
-				return res
+// MacroexpandOnce expands the form if it is a macro call
+func MacroexpandOnce(ctx *LocalScope, form any) (any, bool) {
+	c, ok := form.(*ConsCell)
+	if !ok || c == nil {
+		return form, false
+	}
+	head, ok := c.car.(Atomic)
+	if !ok {
+		return form, false
+	}
+	if fn, ok := lookup(ctx, head).(*Func); ok && fn.expand != nil {
+		return fn.expand(ctx, PairOf(c.cdr)), true
+	}
+	return form, false
+}
+
+// the value of the identifier, nil if it is unbound
+func lookup(ctx *LocalScope, name Atomic) any {
+	if v, ok := ctx.Get(name); ok {
+		return v
+	} else if al, ok := aliasOf(ctx, name); ok {
+		return lookup(al.env, al.name)
+	}
+	return nil
+}
+
+// MacroexpandAll expands the form and all its subforms, but quoted data and parameter lists
+func MacroexpandAll(ctx *LocalScope, form any) any {
+	for expanded := true; expanded; {
+		form, expanded = MacroexpandOnce(ctx, form)
+	}
+	c, ok := form.(*ConsCell)
+	if !ok || c == nil {
+		return form
+	}
+	keep := 0 // leading elements which are not code
+	if head, ok := c.car.(Atomic); ok {
+		if fn, ok := lookup(ctx, head).(*Func); ok && fn.macro {
+			switch stripAlias(head) {
+			case "quote", "syntax-rules", "define-syntax", "let-syntax", "letrec-syntax":
+				return form
+			case "lambda", "define", "defmacro":
+				keep = 2
 			}
-		},
+		}
 	}
+	var elems []any
+	var tail any = c
+	for ; IsCons(tail) && !IsNil(tail); tail = tail.(*ConsCell).cdr {
+		e := tail.(*ConsCell).car
+		if len(elems) >= keep {
+			e = MacroexpandAll(ctx, e)
+		}
+		elems = append(elems, e)
+	}
+	return consAll(elems, tail)
 }
 
 func Defmacro(ctx *LocalScope, name Atomic, argNames Expr, es ...Expr) {
+	ctx.checkWritable("defmacro", name)
 	ctx.Set(name, Macro(ctx, argNames, es...))
 }
 
@@ -176,33 +336,46 @@ func registerMacros(global *LocalScope) {
 	global.Set("macroexpand", &Func{
 		args: ExprOfAny(ConsList[Atomic]("code")),
 		fn: func(ls *LocalScope, p Pair) any {
-			fmt.Println(p.Car())
-			if e, ok := p.Car().(Expr); ok {
-				return Macroexpand(e)
-			}
-			return Macroexpand(ExprOfAny(p.Car().(*ConsCell)))
+			return Macroexpand(ls, ExprOfAny(p.Car()))
+		},
+	})
+
+	global.Set("macroexpand-1", &Func{
+		args: ExprOfAny(ConsList[Atomic]("code")),
+		fn: func(ls *LocalScope, p Pair) any {
+			res, _ := MacroexpandOnce(ls, p.Car())
+			return res
+		},
+	})
+
+	global.Set("macroexpand-all", &Func{
+		args: ExprOfAny(ConsList[Atomic]("code")),
+		fn: func(ls *LocalScope, p Pair) any {
+			return MacroexpandAll(ls, p.Car())
 		},
 	})
 
 	global.Set("unquote", &Func{
 		macro: true,
-		args:  ExprOfAny(ConsList[Atomic]("quasiquoted")),
+		args:  ExprOfAny(ConsList[Atomic]("expr")),
 		fn: func(ls *LocalScope, p Pair) any {
-			return Unquoted{ExprOfAny(p.Car().(*ConsCell))}
+			return Unquoted{p.Car()}.Exec(ls)
 		},
 	})
 
 	global.Set("unquote-splicing", &Func{
 		macro: true,
+		args:  ExprOfAny(ConsList[Atomic]("expr")),
 		fn: func(ls *LocalScope, p Pair) any {
-			return UnquotedSpliced{ExprOfAny(p.Car().(*ConsCell))}
+			return UnquotedSpliced{p.Car()}.Exec(ls)
 		},
 	})
 
 	global.Set("quasiquote", &Func{
 		macro: true,
+		args:  ExprOfAny(ConsList[Atomic]("template")),
 		fn: func(ls *LocalScope, p Pair) any {
-			return Quasiquote(p.Car())
+			return Quasiquote(p.Car()).Substitute(ls)
 		},
 	})
 }
@@ -0,0 +1,404 @@
+package lisp
+
+import (
+	"fmt"
+	"golisp/functional"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Go values in Lisp: exact numbers become int64, *big.Int or *big.Rat (or
+// integers of any size), inexact ones float64, strings string, booleans bool, lists slices and association
+// lists ((key . value) ...) maps and structs. Struct fields are named like in
+// encoding/json: `lisp:"name"` renames the field, `lisp:"-"` skips it.
+// Values with behaviour rather than data (pointers to types with methods,
+// structs without exported fields, functions, channels) become *GoObject.
+
+var (
+	anyType    = reflect.TypeFor[any]()
+	valueType  = reflect.TypeFor[Value]()
+	bigIntType = reflect.TypeFor[*big.Int]()
+	bigRatType = reflect.TypeFor[*big.Rat]()
+)
+
+// FromGo converts the Go value to a Lisp one, values of the Lisp types are kept as they are
+func FromGo(v any) any { return fromGo(reflect.ValueOf(v)) }
+
+// ToGo converts the Lisp value to T, the error is a TypeError telling where the shapes differ
+func ToGo[T any](v any) (T, error) {
+	var res T
+	rv, err := toGo(v, reflect.TypeFor[T]())
+	if err != nil {
+		return res, TypeError{err.Error()}
+	}
+	reflect.ValueOf(&res).Elem().Set(rv)
+	return res, nil
+}
+
+func convertError(v any, t reflect.Type) error {
+	if v == nil {
+		return fmt.Errorf("can not convert () to %s", t)
+	}
+	return fmt.Errorf("can not convert %s of type <%s> to %s", toStr(v), TypeOf(v), t)
+}
+
+// converts the Lisp value to the Go type, Lisp values of the type itself are passed as they are
+func toGo(v any, t reflect.Type) (reflect.Value, error) {
+	if o, ok := v.(*GoObject); ok && o.value.Type().AssignableTo(t) {
+		return o.value, nil
+	}
+	if v != nil && t != anyType && reflect.TypeOf(v).AssignableTo(t) {
+		return reflect.ValueOf(v), nil
+	}
+	if t.Kind() == reflect.Map || t.Kind() == reflect.Struct { // records and tables are like alists
+		if r, ok := v.(*Record); ok {
+			v = r.alist()
+		} else if h, ok := v.(*HashTable); ok {
+			v = h.alist()
+		}
+	}
+
+	switch {
+	case t == bigIntType && IsExact(v) && isInteger(v):
+		return reflect.ValueOf(new(big.Int).Set(toBig(v))), nil
+	case t == bigRatType && IsExact(v):
+		return reflect.ValueOf(new(big.Rat).Set(toRat(v))), nil
+	}
+
+	res := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Interface:
+		if t == anyType {
+			if v := natural(v); v != nil {
+				res.Set(reflect.ValueOf(v))
+			}
+			return res, nil
+		}
+	case reflect.Bool:
+		if b, ok := v.(Boolean); ok {
+			res.SetBool(bool(b))
+			return res, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := integral(v); ok && !res.OverflowInt(int64(n)) {
+			res.SetInt(int64(n))
+			return res, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := integral(v); ok && n >= 0 && !res.OverflowUint(uint64(n)) {
+			res.SetUint(uint64(n))
+			return res, nil
+		} else if b, ok := v.(*BigInt); ok && b.big().IsUint64() && !res.OverflowUint(b.big().Uint64()) {
+			res.SetUint(b.big().Uint64())
+			return res, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if IsNumber(v) {
+			res.SetFloat(toFloat(v))
+			return res, nil
+		}
+	case reflect.String:
+		if s, ok := v.(RawString); ok {
+			res.SetString(string(s))
+			return res, nil
+		} else if c, ok := v.(Char); ok {
+			res.SetString(string(c))
+			return res, nil
+		}
+	case reflect.Slice, reflect.Array:
+		elems, ok := listElems(v)
+		if a, isVector := v.(*Array); isVector {
+			elems, ok = a.storage, true
+		}
+		if ok {
+			if t.Kind() == reflect.Slice {
+				res = reflect.MakeSlice(t, len(elems), len(elems))
+			} else if len(elems) != t.Len() {
+				return res, fmt.Errorf("can not convert a list of %d elements to %s", len(elems), t)
+			}
+			for i, e := range elems {
+				ev, err := toGo(e, t.Elem())
+				if err != nil {
+					return res, fmt.Errorf("element %d: %w", i, err)
+				}
+				res.Index(i).Set(ev)
+			}
+			return res, nil
+		}
+	case reflect.Map:
+		if entries, ok := alistEntries(v); ok {
+			res = reflect.MakeMapWithSize(t, len(entries))
+			for _, e := range entries {
+				k, err := toGo(keyString(e.Car()), t.Key())
+				if err != nil {
+					return res, fmt.Errorf("key: %w", err)
+				}
+				ev, err := toGo(e.Cdr(), t.Elem())
+				if err != nil {
+					return res, fmt.Errorf("%s: %w", toStr(e.Car()), err)
+				}
+				res.SetMapIndex(k, ev)
+			}
+			return res, nil
+		}
+	case reflect.Struct:
+		if entries, ok := alistEntries(v); ok {
+			for _, e := range entries {
+				key, _ := keyString(e.Car()).(RawString)
+				field, ok := structField(t, string(key))
+				if !ok {
+					return res, fmt.Errorf("%s has no field %s", t, toStr(e.Car()))
+				}
+				fv, err := toGo(e.Cdr(), t.FieldByIndex(field.index).Type)
+				if err != nil {
+					return res, fmt.Errorf("%s: %w", field.name, err)
+				}
+				res.FieldByIndex(field.index).Set(fv)
+			}
+			return res, nil
+		}
+	case reflect.Pointer:
+		if IsEmptyList(v) || v == Nil {
+			return res, nil
+		}
+		elem, err := toGo(v, t.Elem())
+		if err != nil {
+			return res, err
+		}
+		res.Set(reflect.New(t.Elem()))
+		res.Elem().Set(elem)
+		return res, nil
+	}
+	return res, convertError(v, t)
+}
+
+// exact integers and inexact ones without a fraction (as read from JSON) convert to Go integers
+func integral(v any) (Integer, bool) {
+	switch n := v.(type) {
+	case Integer:
+		return n, true
+	case Number:
+		if isInteger(n) && math.Abs(float64(n)) < 1<<63 {
+			return Integer(n), true
+		}
+	}
+	return 0, false
+}
+
+// the Go value of the Lisp one without a Go type to convert to
+func natural(v any) any {
+	switch v := v.(type) {
+	case Number:
+		return float64(v)
+	case Integer:
+		return int64(v)
+	case *BigInt:
+		return new(big.Int).Set(v.big())
+	case *Rational:
+		return new(big.Rat).Set(v.rat())
+	case RawString:
+		return string(v)
+	case Char:
+		return string(v)
+	case Boolean:
+		return bool(v)
+	case NilType:
+		return nil
+	case *GoObject:
+		return v.Value()
+	case *ConsCell:
+		if elems, ok := listElems(v); ok {
+			return functional.Map(natural, elems)
+		}
+	case *Array:
+		return functional.Map(natural, v.storage)
+	case *HashTable: // map[string]any if all the keys are strings or symbols
+		keys, values := v.Entries()
+		strs := map[string]any{}
+		for i, k := range keys {
+			if s, ok := keyString(k).(RawString); ok {
+				strs[string(s)] = natural(values[i])
+			}
+		}
+		if len(strs) == len(keys) {
+			return strs
+		}
+		res := map[any]any{}
+		for i, k := range keys {
+			res[natural(k)] = natural(values[i])
+		}
+		return res
+	}
+	return v
+}
+
+// the elements of a proper list
+func listElems(v any) ([]any, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, true
+	case *ConsCell:
+		var res []any
+		for ; v != nil; v, _ = v.cdr.(*ConsCell) {
+			res = append(res, v.car)
+			if !IsCons(v.cdr) && v.cdr != nil {
+				return nil, false
+			}
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+// the pairs of an association list ((key . value) ...)
+func alistEntries(v any) ([]Pair, bool) {
+	elems, ok := listElems(v)
+	if !ok {
+		return nil, false
+	}
+	res := make([]Pair, len(elems))
+	for i, e := range elems {
+		if res[i], ok = e.(*ConsCell); !ok || IsNil(e) {
+			return nil, false
+		}
+	}
+	return res, true
+}
+
+// symbols and keywords used as keys name Go strings
+func keyString(k any) any {
+	switch k := k.(type) {
+	case Atomic:
+		return RawString(k)
+	case Keyword:
+		return RawString(k)
+	}
+	return k
+}
+
+// a struct field seen from Lisp
+type goField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // reflect.Type -> []goField
+
+func structFields(t reflect.Type) []goField {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]goField)
+	}
+	var res []goField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous || throughPointer(t, f.Index) {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("lisp"), ",")
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = f.Name
+		}
+		res = append(res, goField{name, f.Index, opts == "omitempty"})
+	}
+	fieldCache.Store(t, res)
+	return res
+}
+
+// fields promoted from embedded pointers may be unreachable
+func throughPointer(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		if t = t.Field(i).Type; t.Kind() == reflect.Pointer {
+			return true
+		}
+	}
+	return false
+}
+
+// the field of the name, case insensitive if there is no exact match
+func structField(t reflect.Type, name string) (goField, bool) {
+	fields := structFields(t)
+	if i := slices.IndexFunc(fields, func(f goField) bool { return f.name == name }); i >= 0 {
+		return fields[i], true
+	}
+	if i := slices.IndexFunc(fields, func(f goField) bool { return strings.EqualFold(f.name, name) }); i >= 0 {
+		return fields[i], true
+	}
+	return goField{}, false
+}
+
+// converts the Go value to a Lisp one, values of the Lisp types are kept as they are
+func fromGo(rv reflect.Value) any {
+	if !rv.IsValid() {
+		return Nil
+	}
+	if t := rv.Type(); t.Implements(valueType) || t == reflect.TypeFor[Keyword]() {
+		return rv.Interface()
+	} else if t == bigIntType && !rv.IsNil() {
+		return normBig(new(big.Int).Set(rv.Interface().(*big.Int)))
+	} else if t == bigRatType && !rv.IsNil() {
+		return normRat(new(big.Rat).Set(rv.Interface().(*big.Rat)))
+	}
+	switch rv.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if rv.IsNil() {
+			return Nil
+		} else if rv.Kind() == reflect.Pointer && rv.NumMethod() > 0 {
+			return &GoObject{rv}
+		}
+		return fromGo(rv.Elem())
+	case reflect.Bool:
+		return Boolean(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Integer(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return normBig(new(big.Int).SetUint64(rv.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return Number(rv.Float())
+	case reflect.String:
+		return RawString(rv.String())
+	case reflect.Slice, reflect.Array:
+		if rv.Len() == 0 {
+			return EmptyList
+		}
+		res := make([]any, rv.Len())
+		for i := range res {
+			res[i] = fromGo(rv.Index(i))
+		}
+		return ConsList(res...)
+	case reflect.Map:
+		var res []*ConsCell
+		for it := rv.MapRange(); it.Next(); {
+			res = append(res, Cons(fromGo(it.Key()), fromGo(it.Value())))
+		}
+		slices.SortFunc(res, func(a, b *ConsCell) int { // map order is random
+			return strings.Compare(toStr(a.car), toStr(b.car))
+		})
+		h := NewHashTable(EqualComparator)
+		for _, e := range res {
+			h.Set(e.car, e.cdr)
+		}
+		return h
+	case reflect.Struct:
+		fields := structFields(rv.Type())
+		if len(fields) == 0 { // opaque, like time.Time
+			return &GoObject{rv}
+		}
+		var res []any
+		for _, f := range fields {
+			if fv := rv.FieldByIndex(f.index); !f.omitEmpty || !fv.IsZero() {
+				res = append(res, Cons(Atomic(f.name), fromGo(fv)))
+			}
+		}
+		if len(res) == 0 {
+			return EmptyList
+		}
+		return ConsList(res...)
+	}
+	return &GoObject{rv}
+}
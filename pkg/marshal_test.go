@@ -0,0 +1,69 @@
+package lisp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type address struct {
+	City string `lisp:"city"`
+	Zip  string `lisp:"zip,omitempty"`
+}
+
+type person struct {
+	Name    string            `lisp:"name"`
+	Age     int               `lisp:"age"`
+	Tags    []string          `lisp:"tags"`
+	Home    *address          `lisp:"home"`
+	Extra   map[string]string `lisp:"extra"`
+	Secret  string            `lisp:"-"`
+	private int
+}
+
+func Test_FromGo_ToGo(t *testing.T) {
+	p := person{
+		Name:   "Ann",
+		Age:    30,
+		Tags:   []string{"a", "b"},
+		Home:   &address{City: "Oslo"},
+		Extra:  map[string]string{"y": "2", "x": "1"},
+		Secret: "s",
+	}
+	lisp := FromGo(p)
+	assert.Equal(t, `((name . "Ann") (age . 30) (tags "a" "b") (home (city . "Oslo")) (extra . #<hash-table ("x" . "1") ("y" . "2")>))`, toStr(lisp))
+	assert.Equal(t, toStr(lisp), toStr(FromGo(&p)))
+
+	back, err := ToGo[person](lisp)
+	assert.NoError(t, err)
+	p.Secret = ""
+	assert.Equal(t, p, back)
+
+	assert.Equal(t, Nil, FromGo((*person)(nil)))
+	assert.Equal(t, EmptyList, FromGo([]int{}))
+	assert.Equal(t, Number(1.5), FromGo(1.5))
+	assert.Equal(t, Atomic("sym"), FromGo(Atomic("sym")))
+
+	n, err := ToGo[int](Integer(3))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	v, err := ToGo[any](AnyFromExpr(ParseSExpString(`(1 "a" (#t))`)))
+	assert.NoError(t, err)
+	assert.Equal(t, []any{int64(1), "a", []any{true}}, v)
+
+	for _, test := range []struct {
+		code string
+		err  string
+	}{
+		{`((name . 1))`, `type error: name: can not convert 1 of type <lisp.Integer> to string`},
+		{`((tags "a" 2))`, `type error: tags: element 1: can not convert 2 of type <lisp.Integer> to string`},
+		{`((home (town . "x")))`, `type error: home: lisp.address has no field town`},
+		{`((age . 1.5))`, `type error: age: can not convert 1.5 of type <lisp.Number> to int`},
+		{`(1 2)`, `type error: can not convert (1 2) of type <*lisp.ConsCell> to lisp.person`},
+	} {
+		_, err := ToGo[person](AnyFromExpr(ParseSExpString(test.code)))
+		assert.True(t, errors.As(err, new(TypeError)), test.code)
+		assert.EqualError(t, err, test.err, test.code)
+	}
+}
@@ -0,0 +1,602 @@
+package lisp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// The numeric tower: exact Integer, *BigInt and *Rational, inexact Number.
+// Exact results are normalized: big integers fitting in int64 become Integer,
+// rationals with the denominator 1 become integers.
+type (
+	BigInt   big.Int
+	Rational big.Rat
+)
+
+func (b *BigInt) big() *big.Int          { return (*big.Int)(b) }
+func (r *Rational) rat() *big.Rat        { return (*big.Rat)(r) }
+func (b *BigInt) String() string         { return formatNumber(b, 10) }
+func (r *Rational) String() string       { return formatNumber(r, 10) }
+func (b *BigInt) Bool() bool             { return true }
+func (r *Rational) Bool() bool           { return true }
+func (b *BigInt) Exec(*LocalScope) any   { return b }
+func (r *Rational) Exec(*LocalScope) any { return r }
+
+// the printed form of an inexact number always has a point or an exponent, so it reads back inexact
+func (n Number) String() string {
+	f := float64(n)
+	switch {
+	case math.IsNaN(f):
+		return "+nan.0"
+	case math.IsInf(f, 1):
+		return "+inf.0"
+	case math.IsInf(f, -1):
+		return "-inf.0"
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs >= 1e21 || abs != 0 && abs < 1e-7 {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(f, format, -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func (i Integer) String() string { return strconv.FormatInt(int64(i), 10) }
+
+func normBig(b *big.Int) any {
+	if b.IsInt64() {
+		return Integer(b.Int64())
+	}
+	return (*BigInt)(b)
+}
+
+func normRat(r *big.Rat) any {
+	if r.IsInt() {
+		return normBig(new(big.Int).Set(r.Num()))
+	}
+	return (*Rational)(r)
+}
+
+func IsNumber(v any) bool {
+	switch v.(type) {
+	case Integer, *BigInt, *Rational, Number:
+		return true
+	}
+	return false
+}
+
+func IsExact(v any) bool {
+	_, inexact := v.(Number)
+	return IsNumber(v) && !inexact
+}
+
+func numberOf(name string, v any) any {
+	if !IsNumber(v) {
+		panic(TypeError{fmt.Sprintf("%s: <%s> of type <%s> is not a number", name, toStr(v), TypeOf(v))})
+	}
+	return v
+}
+
+// the position in the tower, operations convert both arguments to the higher one
+func numLevel(v any) int {
+	switch v.(type) {
+	case Integer:
+		return 0
+	case *BigInt:
+		return 1
+	case *Rational:
+		return 2
+	}
+	return 3
+}
+
+func toBig(v any) *big.Int {
+	switch v := v.(type) {
+	case Integer:
+		return big.NewInt(int64(v))
+	case *BigInt:
+		return v.big()
+	}
+	panic(TypeError{fmt.Sprintf("<%s> is not an exact integer", toStr(v))})
+}
+
+func toRat(v any) *big.Rat {
+	switch v := v.(type) {
+	case Integer:
+		return new(big.Rat).SetInt64(int64(v))
+	case *BigInt:
+		return new(big.Rat).SetInt(v.big())
+	case *Rational:
+		return v.rat()
+	}
+	panic(TypeError{fmt.Sprintf("<%s> is not an exact number", toStr(v))})
+}
+
+func toFloat(v any) float64 {
+	switch v := v.(type) {
+	case Integer:
+		return float64(v)
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(v.big()).Float64()
+		return f
+	case *Rational:
+		f, _ := v.rat().Float64()
+		return f
+	case Number:
+		return float64(v)
+	}
+	panic(TypeError{fmt.Sprintf("<%s> of type <%s> is not a number", toStr(v), TypeOf(v))})
+}
+
+// Exact converts to an exact number, floats are exactly represented as rationals
+func Exact(v any) any {
+	n, ok := v.(Number)
+	if !ok {
+		return numberOf("exact", v)
+	}
+	f := float64(n)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		panic(TypeError{fmt.Sprintf("exact: %s has no exact representation", n)})
+	} else if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return Integer(f)
+	}
+	return normRat(new(big.Rat).SetFloat64(f))
+}
+
+func Inexact(v any) Number { return Number(toFloat(numberOf("inexact", v))) }
+
+func numAdd(a, b any) any {
+	if x, ok := a.(Integer); ok {
+		if y, ok := b.(Integer); ok {
+			if s := x + y; (s > x) == (y > 0) {
+				return s
+			}
+		}
+	}
+	switch max(numLevel(a), numLevel(b)) {
+	case 0, 1:
+		return normBig(new(big.Int).Add(toBig(a), toBig(b)))
+	case 2:
+		return normRat(new(big.Rat).Add(toRat(a), toRat(b)))
+	}
+	return Number(toFloat(a) + toFloat(b))
+}
+
+func numNeg(a any) any {
+	switch a := a.(type) {
+	case Integer:
+		if a != math.MinInt64 {
+			return -a
+		}
+	case Number:
+		return -a
+	}
+	return numSub(Integer(0), a)
+}
+
+func numSub(a, b any) any {
+	if x, ok := a.(Integer); ok {
+		if y, ok := b.(Integer); ok {
+			if s := x - y; (s < x) == (y > 0) {
+				return s
+			}
+		}
+	}
+	switch max(numLevel(a), numLevel(b)) {
+	case 0, 1:
+		return normBig(new(big.Int).Sub(toBig(a), toBig(b)))
+	case 2:
+		return normRat(new(big.Rat).Sub(toRat(a), toRat(b)))
+	}
+	return Number(toFloat(a) - toFloat(b))
+}
+
+func numMul(a, b any) any {
+	if x, ok := a.(Integer); ok {
+		if y, ok := b.(Integer); ok {
+			if x == 0 || y == 0 {
+				return Integer(0)
+			} else if p := x * y; p/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64) {
+				return p
+			}
+		}
+	}
+	switch max(numLevel(a), numLevel(b)) {
+	case 0, 1:
+		return normBig(new(big.Int).Mul(toBig(a), toBig(b)))
+	case 2:
+		return normRat(new(big.Rat).Mul(toRat(a), toRat(b)))
+	}
+	return Number(toFloat(a) * toFloat(b))
+}
+
+// exact division gives rationals, by an exact zero it fails
+func numDiv(a, b any) any {
+	if numLevel(a) < 3 && numLevel(b) < 3 {
+		d := toRat(b)
+		if d.Sign() == 0 {
+			panic(ExecError{"/: division by zero"})
+		}
+		return normRat(new(big.Rat).Quo(toRat(a), d))
+	}
+	return Number(toFloat(a) / toFloat(b))
+}
+
+// the sign of a - b, false if they are not comparable (NaN)
+func numCompare(a, b any) (int, bool) {
+	if x, ok := a.(Integer); ok {
+		if y, ok := b.(Integer); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	if numLevel(a) < 3 && numLevel(b) < 3 {
+		return toRat(a).Cmp(toRat(b)), true
+	}
+	x, y := toFloat(a), toFloat(b)
+	switch {
+	case math.IsNaN(x) || math.IsNaN(y):
+		return 0, false
+	case math.IsInf(x, 0) || math.IsInf(y, 0) || numLevel(a) == 3 && numLevel(b) == 3:
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	return toRat(Exact(a)).Cmp(toRat(Exact(b))), true // exactly, big integers do not fit in floats
+}
+
+func isInteger(v any) bool {
+	switch v := v.(type) {
+	case Integer, *BigInt:
+		return true
+	case Number:
+		return float64(v) == math.Trunc(float64(v)) && !math.IsInf(float64(v), 0)
+	}
+	return false
+}
+
+func integerOf(name string, v any) any {
+	if !isInteger(v) {
+		panic(TypeError{fmt.Sprintf("%s: <%s> is not an integer", name, toStr(v))})
+	}
+	return v
+}
+
+// quotient, remainder and modulo: exact for exact arguments, inexact if any of them is
+func intDivision(name string, a, b any, op func(x, y *big.Int) *big.Int) any {
+	integerOf(name, a)
+	integerOf(name, b)
+	inexact := !IsExact(a) || !IsExact(b)
+	if inexact {
+		a, b = Exact(a), Exact(b)
+	}
+	if y, ok := b.(Integer); ok && y == 0 {
+		panic(ExecError{name + ": division by zero"})
+	}
+	res := normBig(op(toBig(a), toBig(b)))
+	if inexact {
+		return Inexact(res)
+	}
+	return res
+}
+
+func quotient(x, y *big.Int) *big.Int  { return new(big.Int).Quo(x, y) }
+func remainder(x, y *big.Int) *big.Int { return new(big.Int).Rem(x, y) }
+
+func modulo(x, y *big.Int) *big.Int { // the sign of the divisor
+	m := new(big.Int).Rem(x, y)
+	if m.Sign() != 0 && m.Sign() != y.Sign() {
+		m.Add(m, y)
+	}
+	return m
+}
+
+func gcd(a, b any) any {
+	return normBig(new(big.Int).GCD(nil, nil, new(big.Int).Abs(toBig(a)), new(big.Int).Abs(toBig(b))))
+}
+
+// the exact parts of a rational: numerator and denominator
+func ratParts(name string, v any) (any, any) {
+	switch v := numberOf(name, v).(type) {
+	case Integer, *BigInt:
+		return v, Integer(1)
+	case *Rational:
+		return normBig(new(big.Int).Set(v.rat().Num())), normBig(new(big.Int).Set(v.rat().Denom()))
+	}
+	n, d := ratParts(name, Exact(v))
+	return Inexact(n), Inexact(d)
+}
+
+// the number in the R7RS syntax: 12, -1/2, .5e3, +inf.0 with optional radix
+// (#x #b #o #d) and exactness (#e #i) prefixes; nil if s is not a number
+func parseNumberLiteral(s string, radix int) any {
+	n, _ := readNumber(nil, s, radix)
+	return n
+}
+
+// the exponents of the exact decimals: #e1e100000 is a 41KB integer
+const maxExactExponent = 100000
+
+// parseNumberLiteral with an error for the numbers which can not be made: 1/0, #e1e999999.
+// The exact decimals are charged to the quota of ls as string bytes, if ls is not nil.
+func readNumber(ls *LocalScope, s string, radix int) (any, error) {
+	var exactness byte
+	for len(s) > 2 && s[0] == '#' {
+		switch c := s[1] | 0x20; c { // lower case
+		case 'x':
+			radix = 16
+		case 'b':
+			radix = 2
+		case 'o':
+			radix = 8
+		case 'd':
+			radix = 10
+		case 'e', 'i':
+			if exactness != 0 {
+				return nil, nil
+			}
+			exactness = c
+		default:
+			return nil, nil
+		}
+		s = s[2:]
+	}
+	n, err := parseReal(ls, s, radix, exactness == 'e')
+	switch {
+	case n == nil:
+		return nil, err
+	case exactness == 'e':
+		return Exact(n), nil
+	case exactness == 'i':
+		return Inexact(n), nil
+	}
+	return n, nil
+}
+
+func parseReal(ls *LocalScope, s string, radix int, exact bool) (any, error) {
+	sign := ""
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		sign, s = s[:1], s[1:]
+	}
+	switch special := strings.ToLower(s); {
+	case sign == "+" && special == "inf.0":
+		return Number(math.Inf(1)), nil
+	case sign == "-" && special == "inf.0":
+		return Number(math.Inf(-1)), nil
+	case sign != "" && special == "nan.0":
+		return Number(math.NaN()), nil
+	}
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, d := parseUinteger(sign+num, radix), parseUinteger(den, radix)
+		if n == nil || d == nil {
+			return nil, nil
+		} else if d.Sign() == 0 {
+			return nil, SyntaxError{"division by zero in " + sign + s}
+		}
+		return normRat(new(big.Rat).SetFrac(n, d)), nil
+	} else if isDigits(s, radix) {
+		if i, err := strconv.ParseInt(sign+s, radix, 64); err == nil {
+			return Integer(i), nil
+		}
+		return normBig(parseUinteger(sign+s, radix)), nil
+	} else if radix != 10 || !isDecimal(s) {
+		return nil, nil
+	} else if exact {
+		e := 0
+		if _, exp, ok := strings.Cut(strings.ToLower(s), "e"); ok {
+			var err error
+			if e, err = strconv.Atoi(exp); err != nil || e > maxExactExponent || e < -maxExactExponent {
+				return nil, SyntaxError{"exponent out of range in " + sign + s}
+			}
+		}
+		if ls != nil { // 10^e has e*log2(10) bits
+			ls.allocate(0, (len(s)+max(e, -e))*5/12)
+		}
+		r, ok := new(big.Rat).SetString(sign + s)
+		if !ok {
+			return nil, SyntaxError{"invalid number: " + sign + s}
+		}
+		return normRat(r), nil
+	}
+	f, err := strconv.ParseFloat(sign+s, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) { // out of range is infinity or zero
+		return nil, nil
+	}
+	return Number(f), nil
+}
+
+// the digits with an optional sign
+func parseUinteger(s string, radix int) *big.Int {
+	if !isDigits(strings.TrimPrefix(s, "-"), radix) {
+		return nil
+	}
+	n, _ := new(big.Int).SetString(s, radix)
+	return n
+}
+
+func isDigits(s string, radix int) bool {
+	for _, c := range s {
+		if d := digitValue(c); d < 0 || d >= radix {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func digitValue(c rune) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c|0x20 && c|0x20 <= 'z':
+		return int(c|0x20-'a') + 10
+	}
+	return -1
+}
+
+// digits with at most one point and at least one digit, then an optional exponent: 1. .5 1.5e-3
+func isDecimal(s string) bool {
+	mantissa, exp, hasExp := strings.Cut(strings.ToLower(s), "e")
+	if hasExp && !isDigits(strings.TrimLeft(exp, "+-"), 10) || len(exp) > 0 && strings.LastIndexAny(exp, "+-") > 0 {
+		return false
+	}
+	whole, frac, _ := strings.Cut(mantissa, ".")
+	return (whole != "" || frac != "") && (whole == "" || isDigits(whole, 10)) && (frac == "" || isDigits(frac, 10))
+}
+
+// formatNumber prints the number in the radix, inexact numbers only in 10
+func formatNumber(v any, radix int) string {
+	switch v := v.(type) {
+	case Integer:
+		return strconv.FormatInt(int64(v), radix)
+	case *BigInt:
+		return v.big().Text(radix)
+	case *Rational:
+		return v.rat().Num().Text(radix) + "/" + v.rat().Denom().Text(radix)
+	}
+	if radix != 10 {
+		panic(TypeError{fmt.Sprintf("number->string: inexact %s has no radix %d representation", toStr(v), radix)})
+	}
+	return toStr(v)
+}
+
+// floor, ceiling, truncate and round of exact numbers are exact integers, of inexact ones inexact
+func roundNumber(name string, v any, inexact func(float64) float64, exact func(n, d *big.Int) *big.Int) any {
+	switch v := numberOf(name, v).(type) {
+	case *Rational:
+		return normBig(exact(v.rat().Num(), v.rat().Denom()))
+	case Number:
+		return Number(inexact(float64(v)))
+	default:
+		return v
+	}
+}
+
+// the denominators of rationals are positive, so the euclidean division is the floor one
+func ratFloor(n, d *big.Int) *big.Int    { return new(big.Int).Div(n, d) }
+func ratCeiling(n, d *big.Int) *big.Int  { return new(big.Int).Neg(ratFloor(new(big.Int).Neg(n), d)) }
+func ratTruncate(n, d *big.Int) *big.Int { return new(big.Int).Quo(n, d) }
+
+// to the nearest integer, to the even one of two equally near
+func ratRound(n, d *big.Int) *big.Int {
+	q, m := new(big.Int).DivMod(n, d, new(big.Int))
+	switch c := new(big.Int).Lsh(m, 1).Cmp(d); {
+	case c > 0, c == 0 && q.Bit(0) == 1:
+		q.Add(q, big.NewInt(1))
+	}
+	return q
+}
+
+// the quotient rounded down, for floor/ with modulo as the remainder
+func floorQuotient(x, y *big.Int) *big.Int {
+	q, m := new(big.Int).QuoRem(x, y, new(big.Int))
+	if m.Sign() != 0 && m.Sign() != y.Sign() {
+		q.Sub(q, big.NewInt(1))
+	}
+	return q
+}
+
+func numAbs(v any) any {
+	if n, ok := numberOf("abs", v).(Number); ok {
+		return Number(math.Abs(float64(n)))
+	} else if sign, _ := numCompare(v, Integer(0)); sign < 0 {
+		return numNeg(v)
+	}
+	return v
+}
+
+// min and max, the result is inexact if any of the arguments is
+func numExtreme(name string, args []any, wanted int) any {
+	res := numberOf(name, args[0])
+	inexact := !IsExact(res)
+	for _, a := range args[1:] {
+		inexact = inexact || !IsExact(numberOf(name, a))
+		if sign, ok := numCompare(a, res); !ok {
+			res = Number(math.NaN())
+		} else if sign == wanted {
+			res = a
+		}
+	}
+	if inexact {
+		return Inexact(res)
+	}
+	return res
+}
+
+// exact for exact squares, +nan.0 for negative numbers (there are no complex ones)
+func numSqrt(v any) any {
+	if !IsExact(numberOf("sqrt", v)) {
+		return Number(math.Sqrt(toFloat(v)))
+	}
+	r := toRat(v)
+	if r.Sign() < 0 {
+		return Number(math.NaN())
+	}
+	n, d := new(big.Int).Sqrt(r.Num()), new(big.Int).Sqrt(r.Denom())
+	if res := new(big.Rat).SetFrac(n, d); new(big.Rat).Mul(res, res).Cmp(r) == 0 {
+		return normRat(res)
+	}
+	f, _ := new(big.Float).Sqrt(new(big.Float).SetRat(r)).Float64() // big integers do not fit in floats
+	return Number(f)
+}
+
+// s and r of k = s*s + r
+func exactIntegerSqrt(k any) (any, any) {
+	if !isInteger(k) || !IsExact(k) || toBig(k).Sign() < 0 {
+		panic(TypeError{fmt.Sprintf("exact-integer-sqrt: <%s> is not an exact non-negative integer", toStr(k))})
+	}
+	s := new(big.Int).Sqrt(toBig(k))
+	return normBig(s), normBig(new(big.Int).Sub(toBig(k), new(big.Int).Mul(s, s)))
+}
+
+// exact powers of exact numbers to integer exponents, the string byte quota bounds their size
+func numExpt(ls *LocalScope, base, power any) any {
+	numberOf("expt", base)
+	if !IsExact(base) || !IsExact(numberOf("expt", power)) || !isInteger(power) {
+		return Number(math.Pow(toFloat(base), toFloat(power)))
+	}
+	r, p := toRat(base), toBig(power)
+	if r.Sign() == 0 && p.Sign() < 0 {
+		panic(ExecError{"expt: division by zero"})
+	}
+	n, d, e := r.Num(), r.Denom(), new(big.Int).Abs(p)
+	if trivial := n.CmpAbs(big.NewInt(1)) <= 0 && d.IsInt64() && d.Int64() == 1; !trivial {
+		if !e.IsInt64() || e.Int64() > math.MaxInt32 {
+			panic(ExecError{"expt: the result is too large"})
+		}
+		ls.allocate(0, int(e.Int64())*(n.BitLen()+d.BitLen())/8)
+	}
+	n, d = new(big.Int).Exp(n, e, nil), new(big.Int).Exp(d, e, nil)
+	if p.Sign() < 0 {
+		n, d = d, n
+		if d.Sign() < 0 {
+			n.Neg(n)
+			d.Neg(d)
+		}
+	}
+	return normRat(new(big.Rat).SetFrac(n, d))
+}
+
+// the natural logarithm, also of big integers beyond the float range
+func numLog(v any) float64 {
+	if b, ok := numberOf("log", v).(*BigInt); ok && b.big().Sign() > 0 {
+		k := b.big().BitLen() - 64 // log(m * 2^k) = log(m) + k*log(2)
+		return math.Log(toFloat(normBig(new(big.Int).Rsh(b.big(), uint(k))))) + float64(k)*math.Ln2
+	}
+	return math.Log(toFloat(v))
+}
@@ -0,0 +1,130 @@
+package lisp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_numeric_tower(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	_, err := interp.EvalString(ctx, `(define (fac n) (if (= n 0) 1 (* n (fac (- n 1)))))`)
+	assert.NoError(t, err)
+
+	for _, test := range []struct{ code, expected string }{
+		{`(fac 30)`, `265252859812191058636308480000000`},
+		{`(/ (fac 30) (fac 28))`, `870`},
+		{`(+ 9223372036854775807 1)`, `9223372036854775808`},
+		{`(- -9223372036854775808 1)`, `-9223372036854775809`},
+		{`(* 4294967296 4294967296)`, `18446744073709551616`},
+		{`(- 9223372036854775808 1)`, `9223372036854775807`},
+		{`(/ 1 3)`, `1/3`},
+		{`(/ 6 3)`, `2`},
+		{`(/ 2)`, `1/2`},
+		{`(- 5)`, `-5`},
+		{`(list (- 0.0) (- -0.0) (- 1/2))`, `(-0.0 0.0 -1/2)`},
+		{`(+ 1/3 2/3)`, `1`},
+		{`(* 2/4 3)`, `3/2`},
+		{`(+ 1 0.5)`, `1.5`},
+		{`(* 1/2 1.0)`, `0.5`},
+		{`(/ 1.0 0)`, `+inf.0`},
+		{`#e1.5`, `3/2`},
+		{`#i1/4`, `0.25`},
+		{`(exact 2.0)`, `2`},
+		{`(inexact 1/8)`, `0.125`},
+		{`(list (exact? 1) (exact? 1/2) (exact? 1.0) (inexact? 1.0) (exact-integer? 1/2))`, `(#t #t #f #t #f)`},
+		{`(list (integer? 2.0) (integer? 1/2) (rational? 1/2) (number? 'a))`, `(#t #f #t #f)`},
+		{`(list (= 1 1.0) (< 1/3 0.34) (= 1/2 0.5) (< 1 2 3) (< 1 3 2))`, `(#t #t #t #t #f)`},
+		{`(list (quotient -7 2) (remainder -7 2) (modulo -7 2) (modulo 7 -2))`, `(-3 -1 1 -1)`},
+		{`(modulo -7.0 2)`, `1.0`},
+		{`(list (gcd 12 18) (gcd) (lcm 4 6) (lcm 3 0) (lcm))`, `(6 0 12 0 1)`},
+		{`(list (numerator 6/4) (denominator 6/4) (denominator 5) (denominator 0.5))`, `(3 2 1 2.0)`},
+		{`(list 1.0 100.0 1e21 -0.5)`, `(1.0 100.0 1e+21 -0.5)`},
+		{`(list (number->string 255 16) (number->string -10 2) (number->string 1/3 8) (number->string 1.5))`, `("ff" "-1010" "1/3" "1.5")`},
+		{`(list (string->number "ff" 16) (string->number "#b101") (string->number "1e2") (string->number "abc"))`, `(255 5 100.0 #f)`},
+		{`(string->number (number->string (fac 25) 16) 16)`, `15511210043330985984000000`},
+		{`(list (string->number "1/0") (string->number "#e1e9999999") (string->number "#e1e20000000") (string->number "#e1e-3"))`, `(#f #f #f 1/1000)`},
+		{`(list (string->number "1/0" 16) (inexact (string->number "#e-15e-1")))`, `(#f -1.5)`},
+		{`(list (1+ 1) (1- 1))`, `(2 0)`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	_, err = interp.EvalString(ctx, `(/ 1 0)`)
+	assert.ErrorAs(t, err, new(ExecError))
+	_, err = interp.EvalString(ctx, `(quotient 1 0)`)
+	assert.ErrorAs(t, err, new(ExecError))
+	_, err = interp.EvalString(ctx, `(+ 1 "a")`)
+	assert.ErrorAs(t, err, new(TypeError))
+	for _, code := range []string{`1/0`, `#e1e10000000`, `(+ 1 #e1e-9999999)`, `(read (open-input-string "#e1e200000"))`} {
+		_, err = interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(SyntaxError), code)
+	}
+}
+
+func Test_math(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+
+	for _, test := range []struct{ code, expected string }{
+		{`(list (floor 2.5) (ceiling 2.5) (truncate -2.5) (round 2.5) (round 3.5) (round -2.5))`, `(2.0 3.0 -2.0 2.0 4.0 -2.0)`},
+		{`(list (floor -7/2) (ceiling -7/2) (truncate -7/2) (round 5/2) (round 7/2) (round 7/3) (round 5))`, `(-4 -3 -3 2 4 2 5)`},
+		{`(list (abs -5) (abs -1/2) (abs -2.0) (abs -9223372036854775808))`, `(5 1/2 2.0 9223372036854775808)`},
+		{`(list (min 1 2 3) (max 1 2 3) (max 1 2.0) (min 1/2 1/3))`, `(1 3 2.0 1/3)`},
+		{`(list (square 3) (square 1/2) (square 1.5))`, `(9 1/4 2.25)`},
+		{`(list (sqrt 16) (sqrt 1/4) (sqrt 2.25) (sqrt 2) (sqrt (expt 10 40)))`, `(4 1/2 1.5 1.4142135623730951 100000000000000000000)`},
+		{`(list (exact-integer-sqrt 17) (exact-integer-sqrt 0))`, `((4 1) (0 0))`},
+		{`(list (expt 2 10) (expt 2 -2) (expt 2/3 3) (expt -1/2 -3) (expt 2.0 3) (expt 4 0.5) (expt 0 0))`, `(1024 1/4 8/27 -8 8.0 2.0 1)`},
+		{`(expt 2 100)`, `1267650600228229401496703205376`},
+		{`(list (exp 0) (log 1) (log 100 10) (log 8 2))`, `(1.0 0.0 2.0 3.0)`},
+		{`(< 230.25 (log (expt 10 100)) 230.26)`, `#t`},
+		{`(list (sin 0) (cos 0) (atan 1 1) (* 4 (atan 1)))`, `(0.0 1.0 0.7853981633974483 3.141592653589793)`},
+		{`(list (floor/ 7 2) (floor/ -7 2) (floor/ 7 -2) (truncate/ -7 2))`, `((3 1) (-4 1) (-4 -1) (-3 -1))`},
+		{`(floor/ 7.0 2)`, `(3.0 1.0)`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	_, err := interp.EvalString(ctx, `(expt 0 -1)`)
+	assert.ErrorAs(t, err, new(ExecError))
+	_, err = interp.EvalString(ctx, `(expt 3 10000000000)`)
+	assert.ErrorAs(t, err, new(ExecError))
+	_, err = interp.EvalString(ctx, `(exact-integer-sqrt -1)`)
+	assert.ErrorAs(t, err, new(TypeError))
+
+	limited := New(WithLimits(Limits{MaxStringBytes: 1000}))
+	_, err = limited.EvalString(ctx, `(expt 3 100000)`)
+	assert.ErrorAs(t, err, new(LimitError))
+	_, err = limited.EvalString(ctx, `(string->number "#e1e90000")`)
+	assert.ErrorAs(t, err, new(LimitError))
+}
+
+func Test_random(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+
+	sample := `(let ((s (make-random-source 42)))
+		(list (random-integer 1000 s) (random-integer 1000 s) (random-integer (expt 10 30) s) (random-real s)))`
+	a, err := interp.EvalString(ctx, sample)
+	assert.NoError(t, err)
+	b, err := interp.EvalString(ctx, sample)
+	assert.NoError(t, err)
+	assert.Equal(t, toStr(a), toStr(b))
+
+	res, err := interp.EvalString(ctx, `(list (< -1 (random-integer 10) 10) (< 0 (random-real) 1))`)
+	assert.NoError(t, err)
+	assert.Equal(t, `(#t #t)`, toStr(res))
+
+	n := NewRandomSource(1).Integer(Integer(5))
+	assert.True(t, n.(Integer) >= 0 && n.(Integer) < 5)
+	_, err = interp.EvalString(ctx, `(random-integer 0)`)
+	assert.ErrorAs(t, err, new(TypeError))
+	_, err = interp.EvalString(ctx, `(random-real 1)`)
+	assert.ErrorAs(t, err, new(TypeError))
+}
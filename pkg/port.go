@@ -0,0 +1,382 @@
+package lisp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golisp/parsing"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Port is an input port over an io.Reader or an output port over an io.Writer.
+// The current ports are dynamic: with-output-to-string and the like rebind them
+// for the calls they make, the interpreter ones are set by WithStdout and SetStdout.
+type Port struct {
+	name   string
+	mu     sync.Mutex
+	in     *bufio.Reader    // nil for output ports
+	out    io.Writer        // nil for input ports
+	sb     *strings.Builder // of string output ports
+	closer io.Closer        // of file ports
+	closed bool
+}
+
+type eofObject struct{}
+
+// EOF is the end of file object returned by the reading procedures
+var EOF eofObject
+
+func (eofObject) String() string       { return "#<eof>" }
+func (eofObject) Exec(*LocalScope) any { return EOF }
+func (eofObject) Bool() bool           { return true }
+
+func NewInputPort(name string, r io.Reader) *Port {
+	return &Port{name: name, in: bufio.NewReader(r)}
+}
+
+func NewOutputPort(name string, w io.Writer) *Port { return &Port{name: name, out: w} }
+
+// NewStringPort is an output port collecting what is written, see Port.Output
+func NewStringPort() *Port {
+	sb := &strings.Builder{}
+	return &Port{name: "string", out: sb, sb: sb}
+}
+
+func (p *Port) Exec(*LocalScope) any { return p }
+func (p *Port) Bool() bool           { return true }
+
+func (p *Port) String() string {
+	if p.in != nil {
+		return "#<input-port " + p.name + ">"
+	}
+	return "#<output-port " + p.name + ">"
+}
+
+func (p *Port) IsInput() bool { return p.in != nil }
+
+// Output is what is written to the string port so far
+func (p *Port) Output() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sb == nil {
+		return ""
+	}
+	return p.sb.String()
+}
+
+func (p *Port) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if p.closer != nil {
+		return p.closer.Close()
+	}
+	return nil
+}
+
+// the port locked for the operation, it panics if the port is closed or of the other direction
+func (p *Port) use(name string, input bool) func() {
+	if (p.in != nil) != input {
+		direction := "an output"
+		if input {
+			direction = "an input"
+		}
+		panic(TypeError{fmt.Sprintf("%s: %s is not %s port", name, p, direction)})
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		panic(ExecError{fmt.Sprintf("%s: %s is closed", name, p)})
+	}
+	return p.mu.Unlock
+}
+
+// the rune, EOF at the end; peek leaves it in the port
+func (p *Port) readRune(name string, peek bool) any {
+	defer p.use(name, true)()
+	r, _, err := p.in.ReadRune()
+	if err != nil {
+		return eofOr(name, err)
+	} else if peek {
+		p.in.UnreadRune()
+	}
+	return Char(r)
+}
+
+// the line without the line end, EOF at the end
+func (p *Port) readLine() any {
+	defer p.use("read-line", true)()
+	line, err := p.in.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return eofOr("read-line", err)
+	}
+	return RawString(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+}
+
+// the next datum, EOF at the end; the rune after it is left in the port
+func (p *Port) read() (res any) {
+	defer p.use("read", true)()
+	parser := NewSExpParser(parsing.NewFuncSource(p.in.ReadRune))
+	defer func() {
+		if !parser.Test(parsing.END) { // the lookahead of the parser
+			p.in.UnreadRune()
+		}
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok && errors.Is(err, ErrEOF) {
+				panic(SyntaxError{"read: unexpected end of the datum"})
+			}
+			panic(r)
+		}
+	}()
+	if !parser.More() {
+		return EOF
+	}
+	return parser.readDatum()
+}
+
+// up to k runes, EOF at the end
+func (p *Port) readString(k int) any {
+	defer p.use("read-string", true)()
+	var sb strings.Builder
+	for i := 0; i < k; i++ {
+		r, _, err := p.in.ReadRune()
+		if err != nil && sb.Len() == 0 {
+			return eofOr("read-string", err)
+		} else if err != nil {
+			break
+		}
+		sb.WriteRune(r)
+	}
+	return RawString(sb.String())
+}
+
+func (p *Port) write(name string, s string) {
+	defer p.use(name, false)()
+	if _, err := io.WriteString(p.out, s); err != nil {
+		panic(ExecError{fmt.Sprintf("%s: %v", name, err)})
+	}
+}
+
+func eofOr(name string, err error) any {
+	if errors.Is(err, io.EOF) {
+		return EOF
+	}
+	panic(ExecError{fmt.Sprintf("%s: %v", name, err)})
+}
+
+// the current ports of the dynamic environment, nil ones are the interpreter's
+type currentPorts struct{ in, out, err *Port }
+
+func (d *dynamicEnv) withPorts(ports currentPorts) *dynamicEnv {
+	var res dynamicEnv
+	if d != nil {
+		res = *d
+	}
+	res.ports = &ports
+	return &res
+}
+
+func (l *LocalScope) currentPorts() currentPorts {
+	ports := currentPorts{}
+	if l.dyn != nil && l.dyn.ports != nil {
+		ports = *l.dyn.ports
+	}
+	it := l.Interpreter()
+	if ports.in == nil {
+		ports.in = it.inPort
+	}
+	if ports.out == nil {
+		ports.out = it.outPort
+	}
+	if ports.err == nil {
+		ports.err = it.errPort
+	}
+	return ports
+}
+
+// the port argument at i, the current one if it is missing
+func portOf(name string, args []any, i int, current *Port) *Port {
+	if len(args) <= i {
+		return current
+	} else if p, ok := args[i].(*Port); ok {
+		return p
+	}
+	panic(TypeError{fmt.Sprintf("%s: <%s> is not a port", name, toStr(args[i]))})
+}
+
+func registerPorts(global *LocalScope) {
+	builtin := func(name Atomic, params any, fn func(ls *LocalScope, args []any) any) {
+		global.Set(name, builtinFunc(params, fn))
+	}
+	thunkOf := func(name string, v any) *Func {
+		if fn, ok := v.(*Func); ok {
+			return fn
+		}
+		panic(TypeError{fmt.Sprintf("%s: <%s> is not a procedure", name, toStr(v))})
+	}
+	// the thunk called with the ports replaced, the port is closed after it
+	withPort := func(ls *LocalScope, thunk *Func, port *Port, ports currentPorts) any {
+		defer port.Close()
+		return thunk.Call(ls.withDynamic(ls.dyn.withPorts(ports)), nil)
+	}
+	open := func(name, path string, open func(string) (*os.File, error)) *os.File {
+		f, err := open(path)
+		if err != nil {
+			panic(ExecError{fmt.Sprintf("%s: %v", name, err)})
+		}
+		return f
+	}
+
+	builtin("current-input-port", nil, func(ls *LocalScope, args []any) any {
+		checkArity(args, 0, 0)
+		return ls.currentPorts().in
+	})
+	builtin("current-output-port", nil, func(ls *LocalScope, args []any) any {
+		checkArity(args, 0, 0)
+		return ls.currentPorts().out
+	})
+	builtin("current-error-port", nil, func(ls *LocalScope, args []any) any {
+		checkArity(args, 0, 0)
+		return ls.currentPorts().err
+	})
+	builtin("port?", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		_, ok := checkArity(args, 1, 1)[0].(*Port)
+		return Boolean(ok)
+	})
+	builtin("input-port?", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		p, ok := checkArity(args, 1, 1)[0].(*Port)
+		return Boolean(ok && p.IsInput())
+	})
+	builtin("output-port?", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		p, ok := checkArity(args, 1, 1)[0].(*Port)
+		return Boolean(ok && !p.IsInput())
+	})
+	builtin("eof-object", nil, func(ls *LocalScope, args []any) any {
+		checkArity(args, 0, 0)
+		return EOF
+	})
+	builtin("eof-object?", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		return Boolean(checkArity(args, 1, 1)[0] == EOF)
+	})
+	builtin("close-port", ConsList[Atomic]("port"), func(ls *LocalScope, args []any) any {
+		if err := portOf("close-port", checkArity(args, 1, 1), 0, nil).Close(); err != nil {
+			panic(ExecError{fmt.Sprintf("close-port: %v", err)})
+		}
+		return nil
+	})
+
+	builtin("open-input-string", ConsList[Atomic]("string"), func(ls *LocalScope, args []any) any {
+		s := stringOf("open-input-string", checkArity(args, 1, 1)[0])
+		return &Port{name: "string", in: bufio.NewReader(strings.NewReader(string(s)))}
+	})
+	builtin("open-output-string", nil, func(ls *LocalScope, args []any) any {
+		checkArity(args, 0, 0)
+		return NewStringPort()
+	})
+	builtin("get-output-string", ConsList[Atomic]("port"), func(ls *LocalScope, args []any) any {
+		p := portOf("get-output-string", checkArity(args, 1, 1), 0, nil)
+		if p.sb == nil {
+			panic(TypeError{fmt.Sprintf("get-output-string: %s is not a string port", p)})
+		}
+		s := p.Output()
+		ls.allocate(0, len(s))
+		return RawString(s)
+	})
+	// (with-output-to-string thunk) is what the thunk writes to the current output port
+	builtin("with-output-to-string", ConsList[Atomic]("thunk"), func(ls *LocalScope, args []any) any {
+		thunk := thunkOf("with-output-to-string", checkArity(args, 1, 1)[0])
+		port, ports := NewStringPort(), ls.currentPorts()
+		ports.out = port
+		withPort(ls, thunk, port, ports)
+		s := port.Output()
+		ls.allocate(0, len(s))
+		return RawString(s)
+	})
+	// (call-with-output-file path proc) calls proc with the port of the created file
+	builtin("call-with-output-file", ConsList[Atomic]("path", "proc"), func(ls *LocalScope, args []any) any {
+		path := string(stringOf("call-with-output-file", checkArity(args, 2, 2)[0]))
+		proc := thunkOf("call-with-output-file", args[1])
+		f := open("call-with-output-file", path, os.Create)
+		port := &Port{name: path, out: f, closer: f}
+		defer port.Close()
+		return proc.Call(ls, Cons(port, nil))
+	})
+	// (with-input-from-file path thunk) reads the file as the current input port
+	builtin("with-input-from-file", ConsList[Atomic]("path", "thunk"), func(ls *LocalScope, args []any) any {
+		path := string(stringOf("with-input-from-file", checkArity(args, 2, 2)[0]))
+		thunk := thunkOf("with-input-from-file", args[1])
+		f := open("with-input-from-file", path, os.Open)
+		port, ports := &Port{name: path, in: bufio.NewReader(f), closer: f}, ls.currentPorts()
+		ports.in = port
+		return withPort(ls, thunk, port, ports)
+	})
+
+	builtin("read-char", Atomic("port"), func(ls *LocalScope, args []any) any {
+		return portOf("read-char", checkArity(args, 0, 1), 0, ls.currentPorts().in).readRune("read-char", false)
+	})
+	builtin("peek-char", Atomic("port"), func(ls *LocalScope, args []any) any {
+		return portOf("peek-char", checkArity(args, 0, 1), 0, ls.currentPorts().in).readRune("peek-char", true)
+	})
+	builtin("read-line", Atomic("port"), func(ls *LocalScope, args []any) any {
+		res := portOf("read-line", checkArity(args, 0, 1), 0, ls.currentPorts().in).readLine()
+		if s, ok := res.(RawString); ok {
+			ls.allocate(0, len(s))
+		}
+		return res
+	})
+	// (read-string k [port])
+	builtin("read-string", ConsListDotted[Atomic]("k", "port"), func(ls *LocalScope, args []any) any {
+		k := indexOf("read-string", checkArity(args, 1, 2)[0], math.MaxInt32)
+		res := portOf("read-string", args, 1, ls.currentPorts().in).readString(k)
+		if s, ok := res.(RawString); ok {
+			ls.allocate(0, len(s))
+		}
+		return res
+	})
+	// (read [port]) parses the next datum
+	builtin("read", Atomic("port"), func(ls *LocalScope, args []any) any {
+		return portOf("read", checkArity(args, 0, 1), 0, ls.currentPorts().in).read()
+	})
+	// (write obj [port]) is readable back, cycles are written with datum labels #0= and #0#:
+	// all the shared structure for write-shared, none for write-simple;
+	// display writes strings and characters as they are
+	printing := func(name string, mode printer) {
+		builtin(Atomic(name), ConsListDotted[Atomic]("obj", "port"), func(ls *LocalScope, args []any) any {
+			p := mode // a fresh printer for each call
+			p.ls = ls
+			s := p.print(checkArity(args, 1, 2)[0])
+			portOf(name, args, 1, ls.currentPorts().out).write(name, s)
+			return nil
+		})
+	}
+	printing("write", printer{})
+	printing("write-shared", printer{shared: true})
+	printing("write-simple", printer{simple: true})
+	printing("display", printer{display: true})
+	builtin("write-to-string", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		s := (&printer{ls: ls}).print(checkArity(args, 1, 1)[0])
+		ls.allocate(0, len(s))
+		return RawString(s)
+	})
+	builtin("write-string", ConsListDotted[Atomic]("string", "port"), func(ls *LocalScope, args []any) any {
+		s := stringOf("write-string", checkArity(args, 1, 2)[0])
+		portOf("write-string", args, 1, ls.currentPorts().out).write("write-string", string(s))
+		return nil
+	})
+	builtin("write-char", ConsListDotted[Atomic]("char", "port"), func(ls *LocalScope, args []any) any {
+		c := charOf("write-char", checkArity(args, 1, 2)[0])
+		portOf("write-char", args, 1, ls.currentPorts().out).write("write-char", string(c))
+		return nil
+	})
+	builtin("newline", Atomic("port"), func(ls *LocalScope, args []any) any {
+		portOf("newline", checkArity(args, 0, 1), 0, ls.currentPorts().out).write("newline", "\n")
+		return nil
+	})
+}
@@ -0,0 +1,61 @@
+package lisp
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ports(t *testing.T) {
+	var out, errOut bytes.Buffer
+	interp := New(WithStdin(strings.NewReader("first line\nλx\n")), WithStdout(&out), WithStderr(&errOut))
+	ctx := context.Background()
+
+	for _, test := range []struct{ code, expected string }{
+		{`(with-output-to-string (lambda () (write-string "a") (write-char #\λ) (newline) (display 1)))`, `"aλ\n1"`},
+		{`(with-output-to-string (lambda () (write-string "x") (write-string (with-output-to-string (lambda () (write-string "y"))))))`, `"xy"`},
+		{`(let ((p (open-output-string))) (write-string "ab" p) (write-char #\c p) (get-output-string p))`, `"abc"`},
+		{`(let ((p (open-input-string "añ\nb"))) (list (peek-char p) (read-char p) (read-char p) (read-line p) (read-line p) (read-line p)))`, `(#\a #\a #\ñ "" "b" #<eof>)`},
+		{`(let ((p (open-input-string "héllo"))) (list (read-string 2 p) (read-string 10 p) (read-string 1 p)))`, `("hé" "llo" #<eof>)`},
+		{`(list (read-line) (read-char) (read-line) (eof-object? (read-char)))`, `("first line" #\λ "x" #t)`},
+		{`(list (port? (current-output-port)) (input-port? (current-input-port)) (output-port? (open-input-string "")))`, `(#t #t #f)`},
+		{`(eof-object? (eof-object))`, `#t`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	_, err := interp.EvalString(ctx, `(write-string "out") (display "shown") (write-string "err" (current-error-port))`)
+	assert.NoError(t, err)
+	assert.Equal(t, "outshown", out.String())
+	assert.Equal(t, "err", errOut.String())
+
+	var replaced bytes.Buffer
+	interp.SetStdout(&replaced)
+	_, err = interp.EvalString(ctx, `(newline)`)
+	assert.NoError(t, err)
+	assert.Equal(t, "\n", replaced.String())
+
+	path := filepath.Join(t.TempDir(), "out.txt")
+	interp.Global().Set("path", RawString(path))
+	res, err := interp.EvalString(ctx, `
+		(call-with-output-file path (lambda (p) (write-string "line 1\nline 2\n" p) 'done))
+		(list (with-input-from-file path (lambda () (list (read-line) (read-line) (read-line)))) (with-output-to-string (lambda () #t)))`)
+	assert.NoError(t, err)
+	assert.Equal(t, `(("line 1" "line 2" #<eof>) "")`, toStr(res))
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "line 1\nline 2\n", string(data))
+
+	_, err = interp.EvalString(ctx, `(let ((p (open-input-string "a"))) (close-port p) (read-char p))`)
+	assert.ErrorAs(t, err, new(ExecError))
+	_, err = interp.EvalString(ctx, `(write-char #\a (open-input-string "a"))`)
+	assert.ErrorAs(t, err, new(TypeError))
+	_, err = interp.EvalString(ctx, `(with-input-from-file "/nonexistent/file" (lambda () 1))`)
+	assert.ErrorAs(t, err, new(ExecError))
+}
@@ -0,0 +1,254 @@
+package lisp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// printer makes the external representation of a datum: the written form escapes the
+// strings and symbols so that read gives them back, the displayed one is for humans.
+// The conses and vectors met again are written with datum labels #0= and #0#,
+// only the cyclic ones unless shared is set, none at all for simple.
+type printer struct {
+	display, shared, simple bool
+	ls                      *LocalScope // calls the printers of the record types, nil for the default printing
+
+	state  map[any]int // of the conses and vectors: visiting, visited or labelled
+	labels map[any]int // the numbers of the labels already written
+	sb     strings.Builder
+}
+
+const (
+	visiting = iota + 1
+	visited
+	labelled
+)
+
+func writeString(v any) string   { return (&printer{}).print(v) }
+func displayString(v any) string { return (&printer{display: true}).print(v) }
+
+func (p *printer) print(v any) string {
+	if !p.simple {
+		p.state = map[any]int{}
+		p.scan(v)
+	}
+	p.datum(v)
+	return p.sb.String()
+}
+
+// a cons or a vector that can be part of a cycle
+func isComposite(v any) bool {
+	switch v := v.(type) {
+	case *ConsCell:
+		return !IsNil(v)
+	case *Array:
+		return true
+	}
+	return false
+}
+
+// marks the conses and vectors which need labels, the cdrs are followed without recursion
+func (p *printer) scan(v any) {
+	var chain []any
+	defer func() {
+		for _, c := range chain {
+			if p.state[c] == visiting {
+				p.state[c] = visited
+			}
+		}
+	}()
+	for isComposite(unboxed(v)) {
+		v = unboxed(v)
+		switch p.state[v] {
+		case visiting:
+			p.state[v] = labelled
+			return
+		case visited:
+			if p.shared {
+				p.state[v] = labelled
+			}
+			return
+		case labelled:
+			return
+		}
+		p.state[v] = visiting
+		chain = append(chain, v)
+		if a, ok := v.(*Array); ok {
+			for _, e := range a.storage {
+				p.scan(e)
+			}
+			return
+		}
+		c := v.(*ConsCell)
+		p.scan(c.car)
+		v = c.cdr
+	}
+}
+
+// the datum in the expressions and the abbreviations `x ,x ,@x
+func unboxed(v any) any {
+	for {
+		switch b := v.(type) {
+		case Expr:
+			v = b.value()
+		case abbreviation:
+			v = b.datum()
+		default:
+			return v
+		}
+	}
+}
+
+func (p *printer) datum(v any) {
+	if p.label(v) {
+		return
+	}
+	switch v := v.(type) {
+	case Expr:
+		p.datum(v.value())
+	case *ConsCell:
+		if IsNil(v) {
+			p.sb.WriteString("()")
+			return
+		}
+		p.sb.WriteString("(")
+		p.datum(v.car)
+		for {
+			next, ok := v.cdr.(*ConsCell)
+			if !ok || IsNil(next) || p.state[next] == labelled {
+				break
+			}
+			p.sb.WriteString(" ")
+			p.datum(next.car)
+			v = next
+		}
+		if !IsEmptyList(v.cdr) {
+			p.sb.WriteString(" . ")
+			p.datum(v.cdr)
+		}
+		p.sb.WriteString(")")
+	case *Array:
+		p.sb.WriteString("#(")
+		for i, e := range v.storage {
+			if i > 0 {
+				p.sb.WriteString(" ")
+			}
+			p.datum(e)
+		}
+		p.sb.WriteString(")")
+	case RawString:
+		if p.display {
+			p.sb.WriteString(string(v))
+		} else {
+			p.sb.WriteString(quoteString(string(v), '"'))
+		}
+	case Char:
+		if p.display {
+			p.sb.WriteRune(rune(v))
+		} else {
+			p.sb.WriteString(v.String())
+		}
+	case Atomic:
+		if p.display {
+			p.sb.WriteString(string(v))
+		} else {
+			p.sb.WriteString(v.String())
+		}
+	case *Record:
+		p.record(v)
+	case abbreviation:
+		p.sb.WriteString(v.prefix())
+		p.datum(v.datum())
+	default:
+		p.sb.WriteString(toStr(v))
+	}
+}
+
+// the record printed by the printer of its type, #<name field: value ...> by default
+func (p *printer) record(r *Record) {
+	t := r.rtype
+	switch {
+	case t.proc != nil && p.ls != nil:
+		res := t.proc.Call(p.ls, Cons(r, nil))
+		s, ok := res.(RawString)
+		if !ok {
+			panic(TypeError{fmt.Sprintf("printer of %s: <%s> is not a string", t, toStr(res))})
+		}
+		p.sb.WriteString(string(s))
+	case t.printer != nil:
+		p.sb.WriteString(t.printer(r))
+	default:
+		p.sb.WriteString("#<" + t.name)
+		for i, f := range t.fields {
+			p.sb.WriteString(" " + string(f) + ": ")
+			p.datum(r.values[i])
+		}
+		p.sb.WriteString(">")
+	}
+}
+
+// writes the label of the datum, true if it was already written and #n# is enough
+func (p *printer) label(v any) bool {
+	if !isComposite(v) || p.state[v] != labelled {
+		return false
+	}
+	if n, ok := p.labels[v]; ok {
+		p.sb.WriteString("#" + strconv.Itoa(n) + "#")
+		return true
+	}
+	if p.labels == nil {
+		p.labels = map[any]int{}
+	}
+	n := len(p.labels)
+	p.labels[v] = n
+	p.sb.WriteString("#" + strconv.Itoa(n) + "=")
+	return false
+}
+
+// s between the quotes with the quote, the backslash and the control characters escaped
+func quoteString(s string, quote rune) string {
+	var sb strings.Builder
+	sb.WriteRune(quote)
+	for _, r := range s {
+		switch {
+		case r == quote || r == '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case unicode.IsControl(r) || !unicode.IsPrint(r) && !unicode.IsSpace(r):
+			fmt.Fprintf(&sb, `\x%x;`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteRune(quote)
+	return sb.String()
+}
+
+// the symbol is read back as itself without the bars: |a b|, |1|, |#x|
+func plainSymbol(s string) bool {
+	if s == "" || s == "." || parseNumberLiteral(s, 10) != nil {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', unicode.IsLetter(r):
+		case r >= '0' && r <= '9':
+		case r == '#':
+			if i == 0 {
+				return false
+			}
+		case strings.ContainsRune("~!@%^&*-_+={}/<>?.", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
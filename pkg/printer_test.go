@@ -0,0 +1,80 @@
+package lisp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_write(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+
+	for _, test := range []struct{ code, expected string }{
+		{`(write-to-string "a\"b\\c\nd\te")`, `"\"a\\\"b\\\\c\\nd\\te\""`},
+		{`"bell\a"`, `"bell\x7;"`},
+		{`'(|a b| |1| |#x| |.| || |a\|b| :kw a.b 1+ λ)`, `(|a b| |1| |#x| |.| || |a\|b| :kw a.b 1+ λ)`},
+		{`(string->symbol "-5")`, `|-5|`},
+		{`(with-output-to-string (lambda () (display '("a b" #\c |d e| 1.5))))`, `"(a b c d e 1.5)"`},
+		{`(with-output-to-string (lambda () (write '("a b" #\c))))`, `"(\"a b\" #\\c)"`},
+		{`(let ((l (list 1 2))) (write-to-string (list l l)))`, `"((1 2) (1 2))"`},
+		{`(let ((l (list 1 2))) (with-output-to-string (lambda () (write-shared (list l l)))))`, `"(#0=(1 2) #0#)"`},
+		{`(let ((v (vector 1 2))) (vector-set! v 1 v) (write-to-string v))`, `"#0=#(1 #0#)"`},
+		{`(let ((v (vector 1))) (with-output-to-string (lambda () (write-simple (list v v)))))`, `"(#(1) #(1))"`},
+		{`(read (open-input-string "#0=(a b . #0#)"))`, `#0=(a b . #0#)`},
+		{`(read (open-input-string "(#0=(x) #0# #1=#(#1#))"))`, `((x) (x) #0=#(#0#))`},
+		{`(let ((p (open-input-string "(a \"b\\x41;\" |c d|) foo 12"))) (list (read p) (read-char p) (read p) (read p) (read p)))`,
+			`((a "bA" |c d|) #\space foo 12 #<eof>)`},
+		{`(read (open-input-string "  ; nothing\n"))`, `#<eof>`},
+		{`(read (open-input-string "#;(skipped) #| block #| nested |# ||# (a #;b #;#0=(c) . #;d e) #;x"))`, `(a . e)`},
+		{`(let ((p (open-input-string "#| a |# 1 #;2 #;(3 4) #|x|#"))) (list (read p) (read p)))`, `(1 #<eof>)`},
+		{`(read (open-input-string "#(1 #;2 3 #|4|# #;#(5))"))`, `#(1 3)`},
+		{`(read (open-input-string "#0=(a #;#0# #| #0# |# b . #0#)"))`, `#0=(a b . #0#)`},
+		{`(+ 1 #;2 #| 3 |# 4) #;(car '()) #| end |#`, `5`},
+		{"(with-output-to-string (lambda () (display '`(\"a b\" ,c ,@(#\\d)))))", "\"`(a b ,c ,@(d))\""},
+		{`(equal? '(unquote a) (read (open-input-string ",a")))`, `#t`},
+		{`(read (open-input-string "#0=(a . ,#0#)"))`, "#0=(a . ,#0#)"},
+		{`(read (open-input-string "#0=` + "`" + `(a ,#0# #(,@#0#))"))`, "`#0=(a ,`#0# #(,@`#0#))"},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	for _, datum := range []string{
+		`"quote \" backslash \\ newline \n tab \t nul \x0; λ"`, `|with space|`, `|1.5|`, `||`, `|\x7;|`,
+		`#\a`, `#\space`, `#\x7`, `#\(`, `#\|`, `123456789012345678901234567890`, `-3/4`, `1.5`, `+inf.0`,
+		`(1 (2 "three" #(4 #\5)) . six)`, `#(a "b" (c))`, `()`, `(quote x)`, `:kw`, `#t`, `#f`,
+		"`(a ,b ,@c)", ",a", ",@(a b)", "`(x `(y ,(z ,w)))", "`#(1 ,x)", "(a . ,b)", `(unquote a)`, "`(\"a b\" ,|c d|)",
+	} {
+		code := `(let ((x '` + datum + `)) (equal? x (read (open-input-string (write-to-string x)))))`
+		res, err := interp.EvalString(ctx, code)
+		assert.NoError(t, err, code)
+		assert.Equal(t, True, res, code)
+	}
+
+	for _, datum := range []string{`#0=(a b . #0#)`, `#0=(#0# . #0#)`, `#0=#(1 #0# (#0#))`, `(#0=(x) #0# #1=#(#1#))`, `#0=(a . ,#0#)`, "#0=`(a ,#0#)"} {
+		code := `(let ((x (read (open-input-string "` + datum + `")))) (equal? x (read (open-input-string (write-to-string x)))))`
+		res, err := interp.EvalString(ctx, code)
+		assert.NoError(t, err, code)
+		assert.Equal(t, True, res, code)
+	}
+	res, err := interp.EvalString(ctx, `(equal? (read (open-input-string "#0=(a b . #0#)")) (read (open-input-string "#0=(a b a b . #0#)")))`)
+	assert.NoError(t, err)
+	assert.Equal(t, True, res)
+
+	for _, code := range []string{
+		`(read (open-input-string "(a b"))`,
+		`(read (open-input-string "#| a #| b |# c"))`,
+		`(read (open-input-string "(a #)"))`,
+		`(read (open-input-string "(a # . b)"))`,
+		`(read (open-input-string "#0=,#0#"))`,
+		`(read (open-input-string "#0#"))`,
+		`(read (open-input-string "|abc"))`,
+		`(read (open-input-string "\"\\x110000;\""))`,
+	} {
+		_, err := interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(SyntaxError), code)
+	}
+}
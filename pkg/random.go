@@ -0,0 +1,62 @@
+package lisp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"sync"
+)
+
+// RandomSource is a seedable generator of random numbers, (make-random-source 42)
+// gives the same sequence every time
+type RandomSource struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func NewRandomSource(seed uint64) *RandomSource {
+	return &RandomSource{rnd: rand.New(rand.NewPCG(seed, seed))}
+}
+
+func (s *RandomSource) String() string       { return "#<random-source>" }
+func (s *RandomSource) Exec(*LocalScope) any { return s }
+func (s *RandomSource) Bool() bool           { return true }
+
+// Integer is uniform in [0, n) for the exact positive integer n
+func (s *RandomSource) Integer(n any) any {
+	if !isInteger(n) || !IsExact(n) || toBig(n).Sign() <= 0 {
+		panic(TypeError{fmt.Sprintf("random-integer: <%s> is not an exact positive integer", toStr(n))})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, ok := n.(Integer); ok {
+		return Integer(s.rnd.Int64N(int64(i)))
+	}
+	// 64 bits more than n has make the bias of the modulo negligible
+	buf := make([]byte, (toBig(n).BitLen()+64+63)/64*8)
+	for i := 0; i < len(buf); i += 8 {
+		binary.LittleEndian.PutUint64(buf[i:], s.rnd.Uint64())
+	}
+	return normBig(new(big.Int).Mod(new(big.Int).SetBytes(buf), toBig(n)))
+}
+
+// Real is uniform in (0, 1)
+func (s *RandomSource) Real() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if f := s.rnd.Float64(); f != 0 {
+			return f
+		}
+	}
+}
+
+func randomSourceOf(name string, args []any, i int, def *RandomSource) *RandomSource {
+	if len(args) <= i {
+		return def
+	} else if s, ok := args[i].(*RandomSource); ok {
+		return s
+	}
+	panic(TypeError{fmt.Sprintf("%s: <%s> is not a random source", name, toStr(args[i]))})
+}
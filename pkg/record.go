@@ -0,0 +1,277 @@
+package lisp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RecordType is made by (define-record-type name (ctor field ...) pred (field accessor [modifier]) ...)
+// or by NewRecordType from Go
+type RecordType struct {
+	name    string
+	fields  []Atomic
+	printer func(*Record) string // nil for #<name field: value ...>
+	proc    *Func                // of set-record-type-printer!, called by write and display
+}
+
+// Record is an instance of a RecordType, the fields are in the order of the type
+type Record struct {
+	rtype  *RecordType
+	values []any
+}
+
+// NewRecordType makes a type, its name is used for printing without the <> brackets
+func NewRecordType(name string, fields ...string) *RecordType {
+	t := &RecordType{name: strings.TrimSuffix(strings.TrimPrefix(name, "<"), ">")}
+	for _, f := range fields {
+		t.fields = append(t.fields, Atomic(f))
+	}
+	return t
+}
+
+func (t *RecordType) Name() string { return t.name }
+
+func (t *RecordType) Fields() []string {
+	res := make([]string, len(t.fields))
+	for i, f := range t.fields {
+		res[i] = string(f)
+	}
+	return res
+}
+
+// SetPrinter replaces the default printing of the records, nil restores it
+func (t *RecordType) SetPrinter(fn func(*Record) string) { t.printer, t.proc = fn, nil }
+
+// New makes a record of the values of all the fields
+func (t *RecordType) New(values ...any) *Record {
+	if len(values) > len(t.fields) {
+		panic(TooManyArguments)
+	} else if len(values) < len(t.fields) {
+		panic(TooFewArguments)
+	}
+	return &Record{t, slices.Clone(values)}
+}
+
+func (t *RecordType) String() string       { return "#<record-type " + t.name + ">" }
+func (t *RecordType) Exec(*LocalScope) any { return t }
+func (t *RecordType) Bool() bool           { return true }
+
+func (t *RecordType) index(field Atomic) int { return slices.Index(t.fields, field) }
+
+func (r *Record) Type() *RecordType { return r.rtype }
+
+// Get returns the value of the field, false if the type has no such field
+func (r *Record) Get(field string) (any, bool) {
+	if i := r.rtype.index(Atomic(field)); i >= 0 {
+		return r.values[i], true
+	}
+	return nil, false
+}
+
+// Set changes the value of the field, false if the type has no such field
+func (r *Record) Set(field string, v any) bool {
+	if i := r.rtype.index(Atomic(field)); i >= 0 {
+		r.values[i] = v
+		return true
+	}
+	return false
+}
+
+// String is the default printing, the printer procedures of set-record-type-printer!
+// are called only by the procedures printing in the evaluation: write, display, ...
+func (r *Record) String() string { return writeString(r) }
+
+func (r *Record) DebugString() string {
+	return r.format(func(v any) string { return TypeOf(v) + ":" + toStr(v) })
+}
+
+func (r *Record) format(str func(any) string) string {
+	var sb strings.Builder
+	sb.WriteString("#<" + r.rtype.name)
+	for i, f := range r.rtype.fields {
+		sb.WriteString(" " + string(f) + ": " + str(r.values[i]))
+	}
+	return sb.String() + ">"
+}
+
+func (r *Record) Exec(*LocalScope) any { return r }
+func (r *Record) Bool() bool           { return true }
+
+// as an alist of the fields, the way it converts to Go maps and structs
+func (r *Record) alist() *ConsCell {
+	var res *ConsCell
+	for i := len(r.rtype.fields) - 1; i >= 0; i-- {
+		res = Cons(Cons(r.rtype.fields[i], r.values[i]), res)
+	}
+	return res
+}
+
+// the record of the type, the name of the procedure is for the error message
+func recordOf(name string, t *RecordType, v any) *Record {
+	r, ok := v.(*Record)
+	if !ok || r.rtype != t {
+		panic(TypeError{fmt.Sprintf("%s: <%s> is not a record of type %s", name, toStr(v), t.name)})
+	}
+	return r
+}
+
+// (define-record-type <point> (make-point x y) point? (x point-x set-point-x!) (y point-y))
+func DefineRecordType(ctx *LocalScope, spec Pair) {
+	elems, ok := listElems(spec)
+	if !ok || len(elems) < 3 {
+		panic(SyntaxError{"define-record-type: (define-record-type name constructor predicate field ...) expected"})
+	}
+	typeName, ok := elems[0].(Atomic)
+	if !ok {
+		panic(SyntaxError{"define-record-type: type name expected"})
+	}
+	t := NewRecordType(string(typeName))
+	var procs [][]Atomic // accessor and modifier of every field
+	for _, f := range elems[3:] {
+		names, ok := identifiers(f)
+		if !ok || len(names) < 2 || len(names) > 3 || t.index(names[0]) >= 0 {
+			panic(SyntaxError{fmt.Sprintf("define-record-type: bad field spec %s", toStr(f))})
+		}
+		t.fields = append(t.fields, names[0])
+		procs = append(procs, names[1:])
+	}
+
+	define := func(name Atomic, v any) {
+		ctx.checkWritable("define-record-type", name)
+		if fn, ok := v.(*Func); ok {
+			fn.name = string(name)
+		}
+		ctx.Set(name, v)
+	}
+	define(typeName, t)
+
+	switch ctor := elems[1].(type) {
+	case Atomic: // all the fields in order
+		define(ctor, recordConstructor(t, t.fields))
+	case *ConsCell:
+		names, ok := identifiers(ctor)
+		if !ok || IsNil(ctor) {
+			panic(SyntaxError{"define-record-type: bad constructor spec " + toStr(ctor)})
+		}
+		for _, n := range names[1:] {
+			if t.index(n) < 0 {
+				panic(SyntaxError{fmt.Sprintf("define-record-type: %s is not a field of %s", n, t.name)})
+			}
+		}
+		define(names[0], recordConstructor(t, names[1:]))
+	default:
+		if IsTrue(ctor) {
+			panic(SyntaxError{"define-record-type: bad constructor spec " + toStr(ctor)})
+		}
+	}
+
+	if pred, ok := elems[2].(Atomic); ok {
+		define(pred, &Func{
+			args: ExprOfAny(ConsList[Atomic]("obj")),
+			fn: func(ls *LocalScope, p Pair) any {
+				r, ok := p.Car().(*Record)
+				return Boolean(ok && r.rtype == t)
+			},
+		})
+	} else if IsTrue(elems[2]) {
+		panic(SyntaxError{"define-record-type: bad predicate " + toStr(elems[2])})
+	}
+
+	for i, names := range procs {
+		define(names[0], &Func{
+			args: ExprOfAny(ConsList[Atomic]("record")),
+			fn: func(ls *LocalScope, p Pair) any {
+				return recordOf(string(names[0]), t, p.Car()).values[i]
+			},
+		})
+		if len(names) > 1 {
+			define(names[1], &Func{
+				args: ExprOfAny(ConsList[Atomic]("record", "value")),
+				fn: func(ls *LocalScope, p Pair) any {
+					recordOf(string(names[1]), t, p.Car()).values[i] = PairOf(p.Cdr()).Car()
+					return nil
+				},
+			})
+		}
+	}
+}
+
+// the fields missing in the constructor are #f
+func recordConstructor(t *RecordType, params []Atomic) *Func {
+	return &Func{
+		args: ExprOfAny(ConsList(params...)),
+		fn: func(ls *LocalScope, p Pair) any {
+			args, _ := listElems(p)
+			if len(args) > len(params) {
+				panic(TooManyArguments)
+			} else if len(args) < len(params) {
+				panic(TooFewArguments)
+			}
+			r := &Record{t, make([]any, len(t.fields))}
+			for i := range r.values {
+				r.values[i] = False
+			}
+			for i, n := range params {
+				r.values[t.index(n)] = args[i]
+			}
+			ls.allocate(len(r.values), 0)
+			return r
+		},
+	}
+}
+
+// the symbols of the list
+func identifiers(v any) ([]Atomic, bool) {
+	elems, ok := listElems(v)
+	if !ok {
+		return nil, false
+	}
+	res := make([]Atomic, len(elems))
+	for i, e := range elems {
+		if res[i], ok = e.(Atomic); !ok {
+			return nil, false
+		}
+	}
+	return res, true
+}
+
+func registerRecords(global *LocalScope) {
+	global.Set("define-record-type", &Func{
+		macro: true,
+		args:  ExprOfAny(Cons(Atomic("name"), Cons(Atomic("constructor"), Cons(Atomic("predicate"), Atomic("fields"))))),
+		fn: func(ls *LocalScope, p Pair) any {
+			DefineRecordType(ls, p)
+			return nil
+		},
+	})
+
+	global.Set("record?", &Func{
+		args: ExprOfAny(ConsList[Atomic]("obj")),
+		fn: func(ls *LocalScope, p Pair) any {
+			_, ok := p.Car().(*Record)
+			return Boolean(ok)
+		},
+	})
+
+	// (set-record-type-printer! type (lambda (record) string)), #f restores the default;
+	// the printer runs in the evaluation which prints the record
+	global.Set("set-record-type-printer!", &Func{
+		args: ExprOfAny(ConsList[Atomic]("type", "printer")),
+		fn: func(ls *LocalScope, p Pair) any {
+			t, ok := p.Car().(*RecordType)
+			if !ok {
+				panic(TypeError{fmt.Sprintf("<%s> is not a record type", toStr(p.Car()))})
+			}
+			switch printer := PairOf(p.Cdr()).Car().(type) {
+			case *Func:
+				t.printer, t.proc = nil, printer
+			case Boolean:
+				t.SetPrinter(nil)
+			default:
+				panic(TypeError{fmt.Sprintf("<%s> is not a procedure", toStr(printer))})
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,97 @@
+package lisp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_define_record_type(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	_, err := interp.EvalString(ctx, `
+		(define-record-type <point>
+			(make-point x y)
+			point?
+			(x point-x set-point-x!)
+			(y point-y))
+		(define-record-type node (make-node value) node? (value node-value) (next node-next set-node-next!))
+		(define p (make-point 1 2))`)
+	assert.NoError(t, err)
+
+	for _, test := range []struct{ code, expected string }{
+		{`p`, `#<point x: 1 y: 2>`},
+		{`(list (point? p) (point? 1) (node? p) (record? p))`, `(#t #f #f #t)`},
+		{`(set-point-x! p 10) (+ (point-x p) (point-y p))`, `12`},
+		{`(make-node "a")`, `#<node value: "a" next: #f>`},
+		{`<point>`, `#<record-type point>`},
+		{`(set-record-type-printer! <point> (lambda (p) "<pt>")) (write-to-string (list p))`, `"(<pt>)"`},
+		{`(with-output-to-string (lambda () (display (vector p "a"))))`, `"#(<pt> a)"`},
+		{`(list p)`, `(#<point x: 10 y: 2>)`}, // without an evaluation to run the printer in
+		{`(set-record-type-printer! <point> #f) p`, `#<point x: 10 y: 2>`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	res, _ := interp.EvalString(ctx, `p`)
+	assert.Equal(t, `#<point x: lisp.Integer:10 y: lisp.Integer:2>`, res.(*Record).DebugString())
+
+	for _, code := range []string{`(point-x (make-node 1))`, `(set-point-x! 1 2)`} {
+		_, err := interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(TypeError), code)
+	}
+	_, err = interp.EvalString(ctx, `(make-point 1)`)
+	assert.ErrorIs(t, err, TooFewArguments)
+	_, err = interp.EvalString(ctx, `(define-record-type bad (make-bad z) bad? (x bad-x))`)
+	assert.ErrorAs(t, err, new(SyntaxError))
+
+	_, err = interp.EvalString(ctx, `(set-record-type-printer! <point> (lambda (p port) "two")) (write-to-string p)`)
+	assert.ErrorIs(t, err, TooFewArguments)
+	_, err = interp.EvalString(ctx, `(set-record-type-printer! <point> (lambda (p) 'sym)) (write-to-string p)`)
+	assert.ErrorAs(t, err, new(TypeError))
+	s, err := interp.Write(ctx, ConsList[any](Integer(1), RawString("a")))
+	assert.NoError(t, err)
+	assert.Equal(t, `(1 "a")`, s)
+	p, _ := interp.EvalString(ctx, `p`)
+	_, err = interp.Write(ctx, p)
+	assert.ErrorAs(t, err, new(TypeError))
+
+	deadline, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, err = interp.EvalString(deadline, `(set-record-type-printer! <point> (lambda (r) (let loop () (loop)))) (write-to-string p)`)
+	assert.ErrorAs(t, err, new(InterruptError))
+}
+
+func Test_Record_api(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	pt := NewRecordType("<point>", "x", "y")
+	interp.Global().Set("origin", pt.New(Integer(0), Integer(0)))
+
+	res, err := interp.EvalString(ctx, `(define-record-type point (make-point x y) point? (x point-x) (y point-y)) (make-point 3 4)`)
+	assert.NoError(t, err)
+	r := res.(*Record)
+	assert.Equal(t, "point", r.Type().Name())
+	assert.Equal(t, []string{"x", "y"}, r.Type().Fields())
+	x, ok := r.Get("x")
+	assert.True(t, ok)
+	assert.Equal(t, Integer(3), x)
+	assert.True(t, r.Set("y", Integer(5)))
+	assert.False(t, r.Set("z", Integer(5)))
+
+	type point struct{ X, Y int }
+	p, err := ToGo[point](r)
+	assert.NoError(t, err)
+	assert.Equal(t, point{3, 5}, p)
+
+	res, err = interp.EvalString(ctx, `origin`)
+	assert.NoError(t, err)
+	assert.Equal(t, "#<point x: 0 y: 0>", toStr(res))
+	pt.SetPrinter(func(r *Record) string { return "O" })
+	assert.Equal(t, "O", toStr(res))
+	assert.Panics(t, func() { pt.New(Integer(1)) })
+}
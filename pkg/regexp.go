@@ -0,0 +1,188 @@
+package lisp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Regexp is a compiled regular expression of the Go syntax: (regexp "a+") or #rx"a+".
+// Strings are accepted wherever a regexp is, the positions are in runes.
+type Regexp struct{ re *regexp.Regexp }
+
+// CompileRegexp compiles the pattern, the errors are the ones of regexp.Compile
+func CompileRegexp(pattern string) (*Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Regexp{re}, nil
+}
+
+func (r *Regexp) Regexp() *regexp.Regexp { return r.re }
+func (r *Regexp) Exec(*LocalScope) any   { return r }
+func (r *Regexp) Bool() bool             { return true }
+
+func (r *Regexp) String() string {
+	return `#rx"` + strings.ReplaceAll(r.re.String(), `"`, `\"`) + `"`
+}
+
+func regexpOf(name string, v any) *regexp.Regexp {
+	switch v := v.(type) {
+	case *Regexp:
+		return v.re
+	case RawString:
+		re, err := regexp.Compile(string(v))
+		if err != nil {
+			panic(ExecError{fmt.Sprintf("%s: %v", name, err)})
+		}
+		return re
+	}
+	panic(TypeError{fmt.Sprintf("%s: <%s> is not a regexp", name, toStr(v))})
+}
+
+// the rune index of the byte index of s, the matches start and end at rune boundaries
+func runeOffsets(s string) func(int) Integer {
+	if utf8.RuneCountInString(s) == len(s) {
+		return func(i int) Integer { return Integer(i) }
+	}
+	offsets := make([]Integer, len(s)+1)
+	n := Integer(0)
+	for i := range s {
+		offsets[i] = n
+		n++
+	}
+	offsets[len(s)] = n
+	return func(i int) Integer { return offsets[i] }
+}
+
+// the texts of the submatch indexes: named groups are (name . text), unmatched ones #f
+func submatches(re *regexp.Regexp, s string, loc []int) *ConsCell {
+	names := re.SubexpNames()
+	res := make([]any, len(loc)/2)
+	for i := range res {
+		var text any = False
+		if loc[2*i] >= 0 {
+			text = RawString(s[loc[2*i]:loc[2*i+1]])
+		}
+		if names[i] != "" {
+			text = Cons(Atomic(names[i]), text)
+		}
+		res[i] = text
+	}
+	return ConsList(res...)
+}
+
+// the (start . end) rune positions of the submatch indexes, #f for unmatched groups
+func positions(loc []int, offset func(int) Integer) *ConsCell {
+	res := make([]any, len(loc)/2)
+	for i := range res {
+		res[i] = False
+		if loc[2*i] >= 0 {
+			res[i] = Cons(offset(loc[2*i]), offset(loc[2*i+1]))
+		}
+	}
+	return ConsList(res...)
+}
+
+// s with the matches replaced by the template ($1, ${name}) or the result of the procedure of the match
+func regexpReplace(ls *LocalScope, name string, re *regexp.Regexp, s string, repl any, n int) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, n) {
+		sb.WriteString(s[last:loc[0]])
+		switch repl := repl.(type) {
+		case RawString:
+			sb.Write(re.ExpandString(nil, string(repl), s, loc))
+		case *Func:
+			sb.WriteString(string(stringOf(name, repl.Call(ls, ConsList[any](submatches(re, s, loc))))))
+		default:
+			panic(TypeError{fmt.Sprintf("%s: <%s> is not a string or a procedure", name, toStr(repl))})
+		}
+		last = loc[1]
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+func registerRegexps(global *LocalScope) {
+	builtin := func(name Atomic, params any, fn func(ls *LocalScope, args []any) any) {
+		global.Set(name, builtinFunc(params, fn))
+	}
+	// (name regexp string ...)
+	regexpAndString := func(name string, args []any, min, max int) (*regexp.Regexp, string) {
+		checkArity(args, min, max)
+		return regexpOf(name, args[0]), string(stringOf(name, args[1]))
+	}
+
+	builtin("regexp", ConsList[Atomic]("pattern"), func(ls *LocalScope, args []any) any {
+		return &Regexp{regexpOf("regexp", stringOf("regexp", checkArity(args, 1, 1)[0]))}
+	})
+	builtin("regexp?", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		_, ok := checkArity(args, 1, 1)[0].(*Regexp)
+		return Boolean(ok)
+	})
+	// (regexp-match #rx"(?P<k>\w+)=(\w+)" "a=1") is ("a=1" (k . "a") "1"), #f if there is no match
+	builtin("regexp-match", ConsList[Atomic]("regexp", "string"), func(ls *LocalScope, args []any) any {
+		re, s := regexpAndString("regexp-match", args, 2, 2)
+		loc := re.FindStringSubmatchIndex(s)
+		if loc == nil {
+			return False
+		}
+		ls.allocate(len(loc)/2, len(s))
+		return submatches(re, s, loc)
+	})
+	builtin("regexp-match-all", ConsList[Atomic]("regexp", "string"), func(ls *LocalScope, args []any) any {
+		re, s := regexpAndString("regexp-match-all", args, 2, 2)
+		var res []any
+		for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+			ls.allocate(len(loc)/2+1, loc[1]-loc[0])
+			res = append(res, submatches(re, s, loc))
+		}
+		return NewArray(res...).list()
+	})
+	// (regexp-search #rx"b+" "abbc") is ((1 . 3)), the positions of the match and its groups
+	builtin("regexp-search", ConsListDotted[Atomic]("regexp", "string", "start"), func(ls *LocalScope, args []any) any {
+		re, s := regexpAndString("regexp-search", args, 2, 3)
+		from := 0
+		if len(args) > 2 {
+			start := indexOf("regexp-search", args[2], utf8.RuneCountInString(s))
+			from = len(string([]rune(s)[:start]))
+		}
+		loc := re.FindStringSubmatchIndex(s[from:])
+		if loc == nil {
+			return False
+		}
+		for i := range loc {
+			if loc[i] >= 0 {
+				loc[i] += from
+			}
+		}
+		ls.allocate(len(loc), 0)
+		return positions(loc, runeOffsets(s))
+	})
+	// the replacement is a template with $1 and ${name} or a procedure of the match
+	builtin("regexp-replace", ConsList[Atomic]("regexp", "string", "replacement"), func(ls *LocalScope, args []any) any {
+		re, s := regexpAndString("regexp-replace", args, 3, 3)
+		res := regexpReplace(ls, "regexp-replace", re, s, args[2], 1)
+		ls.allocate(0, len(res))
+		return RawString(res)
+	})
+	builtin("regexp-replace-all", ConsList[Atomic]("regexp", "string", "replacement"), func(ls *LocalScope, args []any) any {
+		re, s := regexpAndString("regexp-replace-all", args, 3, 3)
+		res := regexpReplace(ls, "regexp-replace-all", re, s, args[2], -1)
+		ls.allocate(0, len(res))
+		return RawString(res)
+	})
+	builtin("regexp-split", ConsList[Atomic]("regexp", "string"), func(ls *LocalScope, args []any) any {
+		re, s := regexpAndString("regexp-split", args, 2, 2)
+		parts := re.Split(s, -1)
+		ls.allocate(len(parts), len(s))
+		res := make([]any, len(parts))
+		for i, p := range parts {
+			res[i] = RawString(p)
+		}
+		return NewArray(res...).list()
+	})
+}
@@ -0,0 +1,45 @@
+package lisp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_regexps(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	_, err := interp.EvalString(ctx, `(define log-line #rx"^(?P<level>[A-Z]+) (\d+)ms")`)
+	assert.NoError(t, err)
+
+	for _, test := range []struct{ code, expected string }{
+		{`log-line`, `#rx"^(?P<level>[A-Z]+) (\d+)ms"`},
+		{`(list (regexp? log-line) (regexp? "a") (regexp "a+"))`, `(#t #f #rx"a+")`},
+		{`#rx"say \"hi\"\\"`, `#rx"say \"hi\"\\"`},
+		{`(regexp-match log-line "WARN 120ms slow")`, `("WARN 120ms" (level . "WARN") "120")`},
+		{`(regexp-match log-line "nothing")`, `#f`},
+		{`(regexp-match "a(x)?b" "ab")`, `("ab" #f)`},
+		{`(regexp-match-all #rx"\d+" "1 22 333")`, `(("1") ("22") ("333"))`},
+		{`(regexp-match-all #rx"\d+" "none")`, `()`},
+		{`(regexp-search #rx"b(c)" "ñabc")`, `((2 . 4) (3 . 4))`},
+		{`(list (regexp-search #rx"a" "ñaña" 2) (regexp-search #rx"z" "abc"))`, `(((3 . 4)) #f)`},
+		{`(regexp-replace #rx"(\w+)@(\w+)" "me@host you@there" "$2:$1")`, `"host:me you@there"`},
+		{`(regexp-replace-all #rx"(?P<n>\d+)" "a1b22" "<${n}>")`, `"a<1>b<22>"`},
+		{`(regexp-replace-all #rx"\d+" "a1b22" (lambda (m) (number->string (* 2 (string->number (car m))))))`, `"a2b44"`},
+		{`(regexp-split #rx"\s*,\s*" "a , b,c")`, `("a" "b" "c")`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	_, err = interp.EvalString(ctx, `#rx"("`)
+	assert.ErrorAs(t, err, new(SyntaxError))
+	_, err = interp.EvalString(ctx, `(regexp "(")`)
+	assert.ErrorAs(t, err, new(ExecError))
+	_, err = interp.EvalString(ctx, `(regexp-match 1 "a")`)
+	assert.ErrorAs(t, err, new(TypeError))
+	_, err = interp.EvalString(ctx, `(regexp-replace "a" "a" (lambda (m) 1))`)
+	assert.ErrorAs(t, err, new(TypeError))
+}
@@ -3,16 +3,38 @@ package lisp
 import (
 	"fmt"
 	"golisp/functional"
+	"golisp/parsing"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type (
 	LocalScope struct {
 		parent *LocalScope // constant
 		defs   map[Atomic]any
-		mu     sync.RWMutex
+		mu     *scopeShared // shared with the views of the scope
+		dyn    *dynamicEnv
+		interp *Interpreter // of the global scope
+	}
+
+	scopeShared struct {
+		sync.RWMutex
+		macroID atomic.Int64 // of the scope defining syntax-rules, the aliases name it, see alias
+	}
+
+	// the part of the evaluation state which follows calls, not lexical scopes:
+	// closures take it from the scope they are called from
+	dynamicEnv struct {
+		handlers *handlerFrame
+		thread   *thread
+		ports    *currentPorts // nil for the ones of the interpreter
+	}
+
+	handlerFrame struct {
+		handler *Func // nil for guard, it catches raise-continuable as a usual raise
+		next    *handlerFrame
 	}
 
 	Quoted struct {
@@ -23,60 +45,19 @@ type (
 		isSExpr bool
 		sexp    *ConsCell
 		atom    any
+		pos     *parsing.Position
 	}
 
 	Func struct {
-		macro bool
-		args  Expr
-		code  []Expr
-		fn    func(*LocalScope, Pair) any
+		macro  bool
+		name   string // set by define, used in stack traces
+		args   Expr
+		code   []Expr
+		fn     func(*LocalScope, Pair) any
+		expand func(*LocalScope, Pair) any // of macros producing code, fn evaluates its result
 	}
 )
 
-/*
-  - quoting was restricted in macros
-    example:
-
-  - errs:
-    ```lisp
-
-(define-macro (case val . ps)
-
-	(if (not (null? ps))
-	  `(let ((lst (caar ',ps)) (res ,(cadar ps)))
-	    (cond ((eq? lst 'else) res)
-	          ((member ,val lst) res)
-	          (#t (case ,val ,@(cdr ps)))))))
-
-(case 10 ((1 2 3) 10) (else 20))
-
-```
-
-  - okay:
-    ```lisp
-
-(define-macro (case val . ps)
-
-	(if (not (null? ps))
-	  `(let ((lst (caar (quote ,ps))) (res ,(cadar ps)))
-	    (cond ((eq? lst 'else) res)
-	          ((member ,val lst) res)
-	          (#t (case ,val ,@(cdr ps)))))))
-
-(case 10 ((1 2 3) 10) (else 20))
-```
-
-```go
-func Quote(v any) Quoted { return Quoted{v} }
-```
-main.go:
-```
-
-	fmt.Println(lisp.ParseSExpString("'(+ 1 2)"))
-	fmt.Println(lisp.ParseSExpString("(quote (+ 1 2))"))
-
-```
-*/
 func Quote(v any) *ConsCell {
 	return Cons(Atomic("quote"), Cons(v, nil))
 }
@@ -97,7 +78,7 @@ func (f Func) String() string {
 	args := "()"
 	e := Expr{}
 	if f.args != e {
-		args = toStr(f.args)
+		args = displayString(f.args) // the go parameter types are not symbols: []float64
 	}
 	if f.macro {
 		return fmt.Sprintf("<macro: (macro %s %s)>", args, code)
@@ -106,11 +87,79 @@ func (f Func) String() string {
 	}
 }
 
+func NewScope() *LocalScope {
+	return &LocalScope{
+		defs: make(map[Atomic]any),
+		mu:   &scopeShared{},
+	}
+}
+
 func (l *LocalScope) Sub() *LocalScope {
 	return &LocalScope{
 		parent: l,
 		defs:   make(map[Atomic]any),
+		mu:     &scopeShared{},
+		dyn:    l.dyn,
+	}
+}
+
+// the same bindings seen with another dynamic environment
+func (l *LocalScope) withDynamic(dyn *dynamicEnv) *LocalScope {
+	return &LocalScope{
+		parent: l.parent,
+		defs:   l.defs,
+		mu:     l.mu,
+		dyn:    dyn,
+		interp: l.interp,
+	}
+}
+
+// Interpreter owning the global scope this one derives from, Default for detached scopes
+func (l *LocalScope) Interpreter() *Interpreter {
+	for l.parent != nil {
+		l = l.parent
+	}
+	if l.interp == nil {
+		return Default
+	}
+	return l.interp
+}
+
+// the scope with the exception handler installed
+func (l *LocalScope) withHandler(handler *Func) *LocalScope {
+	return l.withDynamic(l.dyn.withHandlers(&handlerFrame{handler: handler, next: l.dyn.currentHandlers()}))
+}
+
+func (d *dynamicEnv) currentHandlers() *handlerFrame {
+	if d == nil {
+		return nil
 	}
+	return d.handlers
+}
+
+func (d *dynamicEnv) currentThread() *thread {
+	if d == nil {
+		return nil
+	}
+	return d.thread
+}
+
+func (d *dynamicEnv) withHandlers(handlers *handlerFrame) *dynamicEnv {
+	var res dynamicEnv
+	if d != nil {
+		res = *d
+	}
+	res.handlers = handlers
+	return &res
+}
+
+func (d *dynamicEnv) withThread(th *thread) *dynamicEnv {
+	var res dynamicEnv
+	if d != nil {
+		res = *d
+	}
+	res.thread = th
+	return &res
 }
 
 func (l *LocalScope) Get(name Atomic) (any, bool) {
@@ -185,23 +234,93 @@ func info(args any) string {
 	return res
 }
 
+// tailCall is returned by Func.fn in place of a value when the last thing
+// the form does is evaluating expr in scope (lambda body, if branches, macro
+// expansions), so the evaluation loop in Exec finishes it without growing the Go stack
+type tailCall struct {
+	expr  any
+	scope *LocalScope
+}
+
+// finishes the pending tail calls of a raw Func.fn result,
+// base is the depth of the call stack the loop started at
+func trampoline(res any, base int) any {
+	for {
+		tc, ok := res.(*tailCall)
+		if !ok {
+			return res
+		}
+		res = evalStep(tc.expr, tc.scope, base)
+	}
+}
+
+// evaluates a form, but leaves the call in its tail position pending
+func evalStep(v any, l *LocalScope, base int) any {
+	if e := ExprOfAny(v); e.isSExpr {
+		return e.sexp.apply(l, base)
+	} else {
+		return e.Exec(l)
+	}
+}
+
+// calls the function with already evaluated arguments (macros get them unevaluated)
+func (f *Func) Call(ctx *LocalScope, args Pair) any {
+	th := ctx.dyn.currentThread()
+	m := th.begin()
+	res := trampoline(f.invoke(ctx, args, m.frames, f.name), m.frames)
+	th.rewind(m)
+	return res
+}
+
+// closures get a frame of the call stack, a tail call replaces the frame of its caller
+func (f *Func) invoke(ctx *LocalScope, args Pair, base int, name string) any {
+	if th := ctx.dyn.currentThread(); th != nil {
+		th.checkpoint()
+		if len(f.code) > 0 && !f.macro {
+			if f.name != "" {
+				name = f.name
+			}
+			th.enter(base, Frame{Name: name})
+		}
+	}
+	return f.fn(ctx, args)
+}
+
 func (expr *ConsCell) Exec(l *LocalScope) any { // (appl ... args)
+	th := l.dyn.currentThread()
+	m := th.begin()
+	res := trampoline(expr.apply(l, m.frames), m.frames)
+	th.rewind(m)
+	return res
+}
+
+func (expr *ConsCell) apply(l *LocalScope, base int) any {
 	if IsNil(expr) {
 		// panic(SyntaxError{"empty list is not valid"})
 		return EmptyList
 	}
 
+	th := l.dyn.currentThread()
+	th.at(expr.pos)
 	appl, args := expr.Car(), expr.Cdr()
 	if fn, callable := ExprOfAny(appl).Exec(l).(*Func); !callable {
-		panic(fmt.Errorf(`<%s> of type <%s> is not applicable`, appl, TypeOf(appl)))
+		panic(TypeError{fmt.Sprintf(`<%s> of type <%s> is not applicable`, appl, TypeOf(appl))})
 	} else {
-		if fn.macro {
+		name, _ := appl.(Atomic)
+		if fn.expand != nil {
+			th.checkpoint()
+			return &tailCall{expr.expansion(fn, l), l}
+		} else if fn.macro {
 			// fmt.Printf("MACRO '%s' CALL: %s\n", appl, info(args))
-			return fn.fn(l, PairOf(args))
+			return fn.invoke(l, PairOf(args), base, string(name))
 		} else {
-			argsEval := MapCons(func(a any) any { return ExprOfAny(a).Exec(l) }, args)
+			argsEval := MapCons(func(a any) any {
+				l.allocate(1, 0)
+				return ExprOfAny(a).Exec(l)
+			}, args)
 			// fmt.Printf("FUNCTION '%s' CALL: %s\n", appl, info(argsEval))
-			return fn.fn(l, PairOf(argsEval))
+			th.at(expr.pos)
+			return fn.invoke(l, PairOf(argsEval), base, string(name))
 		}
 	}
 }
@@ -3,8 +3,9 @@ package lisp
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"golisp/parsing"
-	"strconv"
+	"math"
 	"strings"
 	"unicode"
 )
@@ -25,6 +26,8 @@ var ErrEOF = errors.New("unexpected end of the source")
 type SExpParser struct {
 	*parsing.BaseParser
 	processing int
+	labels     map[int]any // the datum labels #0= of the expression
+	sharp      bool        // the # was taken by skipComment, it starts the next datum
 
 	SexpStream chan Expr
 	cancel     chan struct{}
@@ -64,24 +67,47 @@ func (parser *SExpParser) Close() {
 	}
 }
 
-func toValue(result any) Expr {
+func toValue(result any, pos *parsing.Position) Expr {
 	if sexp, ok := result.(*ConsCell); ok {
-		return Expr{isSExpr: true, sexp: sexp}
+		return Expr{isSExpr: true, sexp: sexp, pos: pos}
 	} else {
-		return Expr{isSExpr: false, atom: result}
+		return Expr{isSExpr: false, atom: result, pos: pos}
 	}
 }
 
 func (parser *SExpParser) ParseSExpFinal() Expr {
-	if result := parser.parseElement(); parser.Eof() {
-		return toValue(result)
+	parser.labels = nil
+	result, pos := parser.parseElementAt()
+	if parser.Eof() {
+		return toValue(result, pos)
 	}
 	panic(SyntaxError{"end of S-expression expected"})
 }
 
 func (parser *SExpParser) ParseSExp() Expr {
-	result := parser.parseElement()
-	return toValue(result)
+	parser.labels = nil
+	return toValue(parser.parseElementAt())
+}
+
+// the next datum as it is, without the positions of the expressions
+func (parser *SExpParser) readDatum() any {
+	parser.labels = nil
+	return parser.parseElement()
+}
+
+// position of the current rune, nil if the source does not track positions
+func (parser *SExpParser) position() *parsing.Position {
+	if pos := parser.Position(); pos.Line != 0 {
+		return &pos
+	}
+	return nil
+}
+
+// More skips whitespaces and comments, reports if another expression follows
+func (parser *SExpParser) More() bool {
+	parser.skipWhitespaces()
+	parser.skipComment()
+	return !parser.Test(parsing.END)
 }
 
 func (parser *SExpParser) Processing() bool { return parser.processing > 0 }
@@ -97,14 +123,19 @@ func (parser *SExpParser) ParseChar() rune {
 // }
 
 func (parser *SExpParser) parseElement() any {
+	result, _ := parser.parseElementAt()
+	return result
+}
+
+func (parser *SExpParser) parseElementAt() (any, *parsing.Position) {
 	parser.skipWhitespaces()
 	parser.skipComment()
 	parser.skipWhitespaces()
-	result := parser.parseValue()
-	return result
+	pos := parser.position()
+	return parser.parseValue(pos), pos
 }
 
-func (s *SExpParser) parseValue() any {
+func (s *SExpParser) parseValue(pos *parsing.Position) any {
 	if s.Eof() {
 		// source killed when parsin already started
 		// for example: NewStringSource("")
@@ -112,16 +143,44 @@ func (s *SExpParser) parseValue() any {
 		panic(ErrEOF)
 	}
 	switch {
+	case s.sharp || s.Take('#'):
+		s.sharp = false
+		switch {
+		case s.Take('('):
+			return s.parseVector(')')
+		case s.Take('\\'):
+			return s.parseChar()
+		case s.Take('r'):
+			return s.parseRegexp()
+		case s.From("xXbBoOdDeEiI"): // radix and exactness: #x1F #e1.5
+			return s.parseNumber("#")
+		case s.Between('0', '9'):
+			return s.parseLabel()
+		case s.Take('f'):
+			return False
+		case s.Take('t'):
+			return True
+		case s.Take('n'):
+			if s.Take('i') && s.Take('l') {
+				return Nil
+			} else {
+				panic(SyntaxError{"#nil expected"})
+			}
+		default:
+			panic(SyntaxError{"unknown special symbol"})
+		}
 	case s.Take('('):
-		return s.parseList(')')
+		return s.parseList(')').at(pos)
 	case s.Take('['):
-		return s.parseList(']')
+		return s.parseVector(']')
 	case s.Take('"'):
 		return s.parseString()
 	case s.Take(':'):
 		return s.parseKeyword()
+	case s.Take('|'):
+		return s.parseBarSymbol()
 	case s.Take('\''):
-		return Quote(s.parseElement()) // s.parseSymbol()
+		return Quote(s.parseElement()).at(pos) // s.parseSymbol()
 	case s.Take('`'):
 		return Quasiquote(s.parseElement()) // s.parseSymbol()
 	case s.Take(','):
@@ -132,43 +191,29 @@ func (s *SExpParser) parseValue() any {
 		}
 	case s.Take(')'), s.Take(']'):
 		panic(SyntaxError{"unopened braces"})
-	case s.Take('#'):
-		switch {
-		case s.Take('f'):
-			return False
-		case s.Take('t'):
-			return True
-		case s.Take('n'):
-			if s.Take('i') && s.Take('l') {
-				return Nil
-			} else {
-				panic(SyntaxError{"#nil expected"})
-			}
-		default:
-			panic(SyntaxError{"unknown special symbol"})
-		}
 	default:
-		return s.parseAtom()
+		return s.parseAtom("")
 	}
 }
 
 func (parser *SExpParser) consumeLineTillEnd() {
-	for !parser.Take('\n') {
+	for !parser.Take('\n') && !parser.Test(parsing.END) {
 		parser.TakeNext()
 	}
 }
 
+func (parser *SExpParser) identRune() bool {
+	return parser.Between('a', 'z') || parser.Between('A', 'Z') || parser.From("~!@#%^&*-_+={}/<>?.") || // : (keyword may be #:x or ':x)
+		parser.Is(unicode.IsLetter)
+}
+
 func (parser *SExpParser) parseIdent() Atomic {
 	var sb strings.Builder
-	good := func() bool {
-		return parser.Between('a', 'z') || parser.Between('A', 'Z') || parser.From("~!@#%^&*-_+={}/<>?") || // : (keyword may be #:x or ':x)
-			parser.Is(unicode.IsLetter)
-	}
 	// ,.:;'"\|$ special symbols
-	if good() {
+	if parser.identRune() {
 		sb.WriteRune(parser.TakeNext())
 	}
-	for good() || parser.Between('0', '9') {
+	for parser.identRune() || parser.Between('0', '9') {
 		sb.WriteRune(parser.TakeNext())
 	}
 	if sb.Len() == 0 {
@@ -178,12 +223,28 @@ func (parser *SExpParser) parseIdent() Atomic {
 	return Atomic(sb.String())
 }
 
-func (parser *SExpParser) parseAtom() any {
-	if parser.Between('0', '9') {
-		return parser.parseNumber()
-	} else {
-		return parser.parseIdent()
+// the rest of the token after the already taken prefix
+func (parser *SExpParser) takeToken(prefix string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	for parser.identRune() || parser.Between('0', '9') {
+		sb.WriteRune(parser.TakeNext())
+	}
+	return sb.String()
+}
+
+// a number if the token is one (-5 .5 1/2 +inf.0), an identifier otherwise (- ... 1+)
+func (parser *SExpParser) parseAtom(prefix string) any {
+	token := parser.takeToken(prefix)
+	if n, err := readNumber(nil, token, 10); err != nil {
+		panic(err)
+	} else if n != nil {
+		return n
+	} else if token == "" {
+		parser.consumeLineTillEnd()
+		panic(SyntaxError{"wrong identifier format"})
 	}
+	return Atomic(token)
 }
 
 var _ = (*SExpParser).parseSymbol
@@ -199,24 +260,25 @@ func (parser *SExpParser) parseKeyword() Keyword {
 // empty list is 'nil' of type *ConsCell
 // #nil is Nil of type
 func (parser *SExpParser) parseList(end rune) *ConsCell /* any */ {
-	dot := false
 	var list []any
+	var last any = EmptyList
 
-	parser.skipWhitespaces() // `'(  )` -> ()
-	for !parser.Take(end) {
-		list = append(list, parser.parseElement())
-		if parser.skipWhitespaces(); parser.Take('.') {
-			list = append(list, parser.parseElement())
-			dot = true
-			parser.skipWhitespaces()
+	for parser.skipBlank(); !parser.Take(end); parser.skipBlank() { // `'(  )` -> ()
+		if parser.Take('.') {
+			if !parser.atDelimiter() { // .5, identifiers: ..., .-
+				list = append(list, parser.parseAtom("."))
+				continue
+			}
+			if len(list) == 0 { // (. obj Method args ...)
+				list = append(list, Atomic("."))
+				continue
+			}
+			last = parser.parseElement()
+			parser.skipBlank()
 			parser.Expect(end)
 			break
 		}
-	}
-	var last any = EmptyList
-	if dot {
-		n := len(list) - 1
-		list, last = list[:n], list[n]
+		list = append(list, parser.parseElement())
 	}
 	cons := last
 	for i := len(list) - 1; i >= 0; i-- {
@@ -229,6 +291,18 @@ func (parser *SExpParser) parseList(end rune) *ConsCell /* any */ {
 	return cons.(*ConsCell)
 }
 
+// #(1 2 3) or [1 2 3]
+func (parser *SExpParser) parseVector(end rune) *Array {
+	var elems []any
+	for parser.skipBlank(); !parser.Take(end); parser.skipBlank() {
+		if parser.Eof() {
+			panic(SyntaxError{"vector unterminated"})
+		}
+		elems = append(elems, parser.parseElement())
+	}
+	return NewArray(elems...)
+}
+
 // Strings
 func (parser *SExpParser) parseString() RawString { // parse "([String]")
 	var sb strings.Builder
@@ -238,35 +312,7 @@ func (parser *SExpParser) parseString() RawString { // parse "([String]")
 		}
 
 		if parser.Take('\\') {
-
-			if parser.escaped(&sb, '"', '"') ||
-				parser.escaped(&sb, '\\', '\\') ||
-				parser.escaped(&sb, '/', '/') ||
-				parser.escaped(&sb, '\b', 'b') ||
-				parser.escaped(&sb, '\f', 'f') ||
-				parser.escaped(&sb, '\n', 'n') ||
-				parser.escaped(&sb, '\r', 'r') ||
-				parser.escaped(&sb, '\t', 't') {
-				// next char
-			} else if parser.Take('u') {
-				value := 0 // pv // 0
-				for i := 0; i < 4; i++ {
-					value <<= 4
-					if parser.Between('0', '9') {
-						value = parser.nextHex(value, '0')
-					} else if parser.Between('a', 'f') {
-						value = parser.nextHex(value, 'a'-10)
-					} else if parser.Between('A', 'F') {
-						value = parser.nextHex(value, 'A'-10)
-					} else {
-						panic(SyntaxError{"expected hex digit"})
-					}
-				}
-				binary.Write(&sb, binary.BigEndian, int16(value))
-			} else {
-				panic(SyntaxError{"Unknown escape character \\" + string(parser.TakeNext())})
-			}
-
+			parser.parseEscape(&sb)
 		} else {
 			sb.WriteRune(parser.TakeNext())
 		}
@@ -274,6 +320,50 @@ func (parser *SExpParser) parseString() RawString { // parse "([String]")
 	return RawString(sb.String())
 }
 
+// the character after the backslash of a string or a |symbol|
+func (parser *SExpParser) parseEscape(sb *strings.Builder) {
+	if parser.escaped(sb, '"', '"') ||
+		parser.escaped(sb, '\\', '\\') ||
+		parser.escaped(sb, '|', '|') ||
+		parser.escaped(sb, '/', '/') ||
+		parser.escaped(sb, '\a', 'a') ||
+		parser.escaped(sb, '\b', 'b') ||
+		parser.escaped(sb, '\f', 'f') ||
+		parser.escaped(sb, '\n', 'n') ||
+		parser.escaped(sb, '\r', 'r') ||
+		parser.escaped(sb, '\t', 't') {
+		// next char
+	} else if parser.Take('x') { // \x3bb; is a code point
+		value := 0
+		for !parser.Take(';') {
+			if value = parser.hexDigit(value); value > unicode.MaxRune {
+				panic(SyntaxError{"escaped code point out of range"})
+			}
+		}
+		sb.WriteRune(rune(value))
+	} else if parser.Take('u') {
+		value := 0 // pv // 0
+		for i := 0; i < 4; i++ {
+			value = parser.hexDigit(value)
+		}
+		binary.Write(sb, binary.BigEndian, int16(value))
+	} else {
+		panic(SyntaxError{"Unknown escape character \\" + string(parser.TakeNext())})
+	}
+}
+
+func (parser *SExpParser) hexDigit(value int) int {
+	value <<= 4
+	if parser.Between('0', '9') {
+		return parser.nextHex(value, '0')
+	} else if parser.Between('a', 'f') {
+		return parser.nextHex(value, 'a'-10)
+	} else if parser.Between('A', 'F') {
+		return parser.nextHex(value, 'A'-10)
+	}
+	panic(SyntaxError{"expected hex digit"})
+}
+
 func (parser *SExpParser) nextHex(value, delta int) int {
 	value += int(parser.TakeNext()) - delta
 	return value
@@ -287,50 +377,135 @@ func (parser *SExpParser) escaped(sb *strings.Builder, character, expected rune)
 	return consumed
 }
 
-// Numbers
-func (parser *SExpParser) parseNumber() Number {
+// |a symbol| of any characters, with the escapes of the strings
+func (parser *SExpParser) parseBarSymbol() Atomic {
 	var sb strings.Builder
-	parser.takeInteger(&sb)
+	for !parser.Take('|') {
+		if parser.Eof() {
+			panic(SyntaxError{"symbol unterminated"})
+		} else if parser.Take('\\') {
+			parser.parseEscape(&sb)
+		} else {
+			sb.WriteRune(parser.TakeNext())
+		}
+	}
+	return Atomic(sb.String())
+}
+
+// Datum labels: #0=(a . #0#) is a cyclic list
+type labelPlaceholder struct{ n int }
 
-	if parser.Take('.') { // fraction
-		sb.WriteRune('.')
-		parser.takeDigits(&sb)
+func (parser *SExpParser) parseLabel() any {
+	n := 0
+	for parser.Between('0', '9') {
+		if n > math.MaxInt32/10 {
+			panic(SyntaxError{"datum label out of range"})
+		}
+		n = n*10 + int(parser.TakeNext()-'0')
 	}
+	switch {
+	case parser.Take('#'):
+		if v, ok := parser.labels[n]; ok {
+			return v
+		}
+		panic(SyntaxError{fmt.Sprintf("undefined datum label #%d#", n)})
+	case parser.Take('='):
+		if parser.labels == nil {
+			parser.labels = map[int]any{}
+		}
+		placeholder := &labelPlaceholder{n}
+		parser.labels[n] = placeholder
+		v := parser.parseElement()
+		if unboxed(v) == any(placeholder) {
+			panic(SyntaxError{fmt.Sprintf("datum label #%d= of itself", n)})
+		}
+		parser.labels[n] = v
+		replacePlaceholder(unboxed(v), placeholder, v, map[any]bool{})
+		return v
+	}
+	panic(SyntaxError{"# or = expected after the datum label"})
+}
 
-	if parser.Take('e') || parser.Take('E') { // exponent
-		sb.WriteRune('e')
-		if parser.Take('+') { // sign of exponent
-			// nothing
-		} else if parser.Take('-') {
-			sb.WriteRune('-')
+// the references to the label in the conses and vectors of v are made to the datum
+func replacePlaceholder(v any, placeholder *labelPlaceholder, datum any, seen map[any]bool) {
+	for isComposite(v) && !seen[v] {
+		seen[v] = true
+		if a, ok := v.(*Array); ok {
+			for i, e := range a.storage {
+				a.storage[i] = replaced(e, placeholder, datum, seen)
+			}
+			return
+		}
+		c := v.(*ConsCell)
+		c.car = replaced(c.car, placeholder, datum, seen)
+		if _, ok := c.cdr.(abbreviation); ok || c.cdr == any(placeholder) { // (a . ,#0#)
+			c.cdr = replaced(c.cdr, placeholder, datum, seen)
 		}
-		parser.takeDigits(&sb)
+		v = c.cdr
 	}
+}
 
-	val, err := strconv.ParseFloat(sb.String(), 64)
-	if err != nil {
-		panic(SyntaxError{"invalid number: " + err.Error()})
+// the element e with the references to the label made to the datum, a new abbreviation if it is one
+func replaced(e any, placeholder *labelPlaceholder, datum any, seen map[any]bool) any {
+	if e == any(placeholder) {
+		return datum
+	} else if a, ok := e.(abbreviation); ok {
+		return a.with(replaced(a.datum(), placeholder, datum, seen))
 	}
-	return Number(val)
+	replacePlaceholder(e, placeholder, datum, seen)
+	return e
 }
 
-func (parser *SExpParser) takeDigits(sb *strings.Builder) {
-	for parser.Between('0', '9') {
-		sb.WriteRune(parser.TakeNext())
+// Characters: #\a #\( #\space #\x41
+func (parser *SExpParser) parseChar() Char {
+	if parser.Eof() {
+		panic(SyntaxError{"character expected after #\\"})
 	}
+	name := parser.takeToken(string(parser.TakeNext()))
+	if c, ok := charOfName(name); ok {
+		return c
+	}
+	panic(SyntaxError{"unknown character #\\" + name})
 }
 
-func (parser *SExpParser) takeInteger(sb *strings.Builder) {
-	if parser.Take('-') {
-		sb.WriteRune('-')
+// #rx"a+\d" is compiled at read time, the backslashes are kept but \" is a quote
+func (parser *SExpParser) parseRegexp() *Regexp {
+	if !parser.Take('x') || !parser.Take('"') {
+		panic(SyntaxError{"#rx\"...\" expected"})
 	}
-	if parser.Take('0') {
-		sb.WriteRune('0')
-	} else if parser.Between('1', '9') {
-		parser.takeDigits(sb)
-	} else {
-		panic(SyntaxError{"invalid number"})
+	var sb strings.Builder
+	for !parser.Take('"') {
+		if parser.Eof() {
+			panic(SyntaxError{"regexp unterminated"})
+		} else if parser.Take('\\') {
+			switch {
+			case parser.Take('"'):
+				sb.WriteRune('"')
+			case parser.Take('\\'): // an escaped backslash, not an escape of what follows
+				sb.WriteString(`\\`)
+			default:
+				sb.WriteRune('\\')
+			}
+			continue
+		}
+		sb.WriteRune(parser.TakeNext())
 	}
+	re, err := CompileRegexp(sb.String())
+	if err != nil {
+		panic(SyntaxError{err.Error()})
+	}
+	return re
+}
+
+// Numbers
+func (parser *SExpParser) parseNumber(prefix string) any {
+	token := parser.takeToken(prefix)
+	if n, err := readNumber(nil, token, 10); err != nil {
+		panic(err)
+	} else if n != nil {
+		return n
+	}
+	panic(SyntaxError{"invalid number: " + token})
 }
 
 // Whitespaces
@@ -341,14 +516,63 @@ func (parser *SExpParser) skipWhitespaces() { // hangs in waiting
 	}
 }
 
+func (parser *SExpParser) skipBlank() {
+	parser.skipWhitespaces()
+	parser.skipComment()
+}
+
+// the end of a token
+func (parser *SExpParser) atDelimiter() bool {
+	return parser.Eof() || parser.From(" \t\n\r()[]\";")
+}
+
+// skips the line comments ; and the block ones #| ... |#, the datum after a #; too
 func (parser *SExpParser) skipComment() {
 	// if parser.Take(';') {
 	// 	for !parser.Take('\n') {
 	// 		parser.TakeNext()
 	// 	}
 	// }
-	for parser.Take(';') {
-		parser.consumeLineTillEnd()
+	for !parser.sharp {
+		switch {
+		case parser.Take(';'):
+			parser.consumeLineTillEnd()
+		case parser.Take('#'):
+			switch {
+			case parser.Take('|'):
+				parser.skipBlockComment()
+			case parser.Take(';'):
+				parser.parseElement()
+			default: // #( #t #\a ... left to parseValue
+				if parser.Eof() || parser.From(" \t\n\r)].") { // the lists would take them
+					panic(SyntaxError{"unknown special symbol"})
+				}
+				parser.sharp = true
+				return
+			}
+		default:
+			return
+		}
 		parser.skipWhitespaces()
 	}
 }
+
+// the block comments nest: #| a #| b |# c |#
+func (parser *SExpParser) skipBlockComment() {
+	for depth := 1; depth > 0; {
+		switch {
+		case parser.Eof():
+			panic(SyntaxError{"block comment unterminated"})
+		case parser.Take('|'):
+			if parser.Take('#') {
+				depth--
+			}
+		case parser.Take('#'):
+			if parser.Take('|') {
+				depth++
+			}
+		default:
+			parser.TakeNext()
+		}
+	}
+}
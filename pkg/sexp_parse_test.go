@@ -1,6 +1,8 @@
 package lisp
 
 import (
+	"golisp/parsing"
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,13 +15,53 @@ func TestEmpty(t *testing.T) {
 	assert.True(t, IsEmptyList(x))
 	var y any = x
 	assert.True(t, IsEmptyList(y))
-	assert.False(t, IsEmptyList(Number(10)))
-	assert.False(t, IsEmptyList(Cons(Atomic("a"), Number(10))))
+	assert.False(t, IsEmptyList(Integer(10)))
+	assert.False(t, IsEmptyList(Cons(Atomic("a"), Integer(10))))
 }
 
 func Test_basicParse_Number_1(t *testing.T) {
 	s := ParseSExpString("123")
-	assert.Equal(t, s.atom.(Number), Number(123))
+	assert.Equal(t, Integer(123), s.atom.(Integer))
+}
+
+func Test_basicParse_Numbers(t *testing.T) {
+	for _, test := range []struct {
+		val string
+		res any
+	}{
+		{`-5`, Integer(-5)},
+		{`+3`, Integer(3)},
+		{`007`, Integer(7)},
+		{`.5`, Number(0.5)},
+		{`-.5e1`, Number(-5)},
+		{`1e3`, Number(1000)},
+		{`1.`, Number(1)},
+		{`#x1F`, Integer(31)},
+		{`#b-1010`, Integer(-10)},
+		{`#o17`, Integer(15)},
+		{`#X1e3`, Integer(0x1e3)},
+		{`#e1.25`, parseNumberLiteral("5/4", 10)},
+		{`#x#i10`, Number(16)},
+		{`#i#b1/10`, Number(0.5)},
+		{`-1/2`, parseNumberLiteral("-1/2", 10)},
+		{`-`, Atomic("-")},
+		{`+`, Atomic("+")},
+		{`...`, Atomic("...")},
+		{`->x`, Atomic("->x")},
+		{`1+`, Atomic("1+")},
+		{`.`, Atomic(".")},
+		{`inf.0`, Atomic("inf.0")},
+		{`1e`, Atomic("1e")},
+	} {
+		assert.Equal(t, test.res, ParseSExpString(test.val).atom, test.val)
+	}
+	assert.True(t, math.IsInf(float64(ParseSExpString(`+inf.0`).atom.(Number)), 1))
+	assert.True(t, math.IsInf(float64(ParseSExpString(`-inf.0`).atom.(Number)), -1))
+	assert.True(t, math.IsNaN(float64(ParseSExpString(`-nan.0`).atom.(Number))))
+	assert.Equal(t, ConsList[any](Atomic("a"), Number(0.5), Atomic("..."), Integer(-1)).String(),
+		ParseSExpString(`(a .5 ... -1)`).String())
+	assert.Panics(t, func() { ParseSExpString(`#xZZ`) })
+	assert.Panics(t, func() { ParseSExpString(`#e#i1`) })
 }
 
 func Test_basicParse_String(t *testing.T) {
@@ -56,7 +98,7 @@ func Test_basicParse_Keyword(t *testing.T) {
 func Test_basicParse_SExpr(t *testing.T) {
 	var (
 		code   = "(+ a 10)"
-		parsed = Cons(Atomic("+"), Cons(Atomic("a"), Cons(Number(10), nil)))
+		parsed = Cons(Atomic("+"), Cons(Atomic("a"), Cons(Integer(10), nil)))
 	)
 	sexp := ParseSExpString(code)
 	res := sexp.String()
@@ -69,16 +111,16 @@ func Test_basicParse_Lists(t *testing.T) {
 		res any
 	}{
 		{`()`, EmptyList},
-		{`(1 2 3 10)`, ConsList[Number](1, 2, 3, 10)},
-		{`(1 . (2 3 . (4 . ())))`, ConsList[Number](1, 2, 3, 4)},
+		{`(1 2 3 10)`, ConsList[Integer](1, 2, 3, 10)},
+		{`(1 . (2 3 . (4 . ())))`, ConsList[Integer](1, 2, 3, 4)},
 		{`(a)`, ConsList[Atomic]("a")},
 		//{`(. a)`, ConsListDotted[Atomic]("a")},
-		{`(1 . x)`, Cons(Number(1), Atomic("x"))},
-		{`(1 2 . 3)`, ConsListDotted[Number](1, 2, 3)},
-		{`(1 2 . ())`, ConsList[Number](1, 2)},
-		{`(1 2 . (3))`, ConsList[Number](1, 2, 3)},
-		{`(1 2 . (4 5))`, ConsList[Number](1, 2, 4, 5)},
-		{`(1 2 . (4 5 . 6))`, ConsListDotted[Number](1, 2, 4, 5, 6)},
+		{`(1 . x)`, Cons(Integer(1), Atomic("x"))},
+		{`(1 2 . 3)`, ConsListDotted[Integer](1, 2, 3)},
+		{`(1 2 . ())`, ConsList[Integer](1, 2)},
+		{`(1 2 . (3))`, ConsList[Integer](1, 2, 3)},
+		{`(1 2 . (4 5))`, ConsList[Integer](1, 2, 4, 5)},
+		{`(1 2 . (4 5 . 6))`, ConsListDotted[Integer](1, 2, 4, 5, 6)},
 	} {
 		actual := ParseSExpString(test.val)
 		assert.True(t, actual.isSExpr)
@@ -111,7 +153,7 @@ var factorial = Cons(
 			Cons(Cons(Atomic("if"), Cons(gt_n_0,
 				Cons(Cons(Atomic("*"), Cons(Atomic("n"),
 					Cons(Cons(Atomic("fac"), Cons(sub_n_1, nil)), nil))),
-					Cons(Number(1), nil)))), nil))), nil)))
+					Cons(Integer(1), nil)))), nil))), nil)))
 
 func Test_basicParse_Function_factorial(t *testing.T) {
 	sexp := ParseSExpString(factorial_code)
@@ -119,3 +161,13 @@ func Test_basicParse_Function_factorial(t *testing.T) {
 }
 
 // 	sexp := ParseSExpString(`'(1 2 3 nil ())`)
+
+func Test_basicParse_Positions(t *testing.T) {
+	sexp := ParseSExp(parsing.NewStringSource("\n  (a\n   (b 'c))").Named("f.scm"))
+	assert.Equal(t, "f.scm:2:3", sexp.Pos().String())
+	inner := sexp.sexp.Cdr().(*ConsCell).Car().(*ConsCell)
+	assert.Equal(t, "f.scm:3:4", inner.Pos().String())
+	quoted := inner.Cdr().(*ConsCell).Car().(*ConsCell)
+	assert.Equal(t, "f.scm:3:7", quoted.Pos().String())
+	assert.Nil(t, Cons(Integer(1), nil).Pos())
+}
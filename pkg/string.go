@@ -0,0 +1,327 @@
+package lisp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Strings are immutable RawStrings, the indexes and lengths are in runes
+
+func stringOf(name string, v any) RawString {
+	s, ok := v.(RawString)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("%s: <%s> of type <%s> is not a string", name, toStr(v), TypeOf(v))})
+	}
+	return s
+}
+
+// the string with the case folded, the strings equal by string-ci=? have the same folding:
+// the full folding of Unicode where "Straße" and "STRASSE" both give "strasse"
+func foldString(s string) string { return mapCase(s, foldSpecial, foldCase) }
+
+// the string in upper case with the full mappings of Unicode, "straße" is "STRASSE"
+func upcaseString(s string) string { return mapCase(s, upperSpecial, unicode.ToUpper) }
+
+// maps the runes with more than one rune in the special table, one by one with simple otherwise
+func mapCase(s string, special map[rune]string, simple func(rune) rune) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for _, r := range s {
+		if m, ok := special[r]; ok {
+			sb.WriteString(m)
+		} else {
+			sb.WriteRune(simple(r))
+		}
+	}
+	return sb.String()
+}
+
+// the runes of the string and the [start, end) range of the optional arguments
+func runeRange(name string, v any, args []any) ([]rune, int, int) {
+	runes := []rune(string(stringOf(name, v)))
+	start, end := sliceRange(name, len(runes), args)
+	return runes, start, end
+}
+
+// a character or a predicate on characters: #\a, char-whitespace?
+func runeMatcher(ls *LocalScope, name string, v any) func(rune) bool {
+	switch v := v.(type) {
+	case Char:
+		return func(r rune) bool { return r == rune(v) }
+	case *Func:
+		return func(r rune) bool { return IsTrue(v.Call(ls, ConsList(Char(r)))) }
+	}
+	panic(TypeError{fmt.Sprintf("%s: <%s> is not a character or a predicate", name, toStr(v))})
+}
+
+// the rune index of the byte index i of s
+func runeIndex(s string, i int) Integer { return Integer(utf8.RuneCountInString(s[:i])) }
+
+// the strings of the list
+func stringList(name string, v any) []string {
+	elems, ok := listElems(v)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("%s: <%s> is not a list", name, toStr(v))})
+	}
+	res := make([]string, len(elems))
+	for i, e := range elems {
+		res[i] = string(stringOf(name, e))
+	}
+	return res
+}
+
+// n runes of the string, padded with c or cut on the left (or right)
+func pad(s []rune, n int, c rune, right bool) string {
+	switch {
+	case len(s) >= n && right:
+		return string(s[:n])
+	case len(s) >= n:
+		return string(s[len(s)-n:])
+	case right:
+		return string(s) + strings.Repeat(string(c), n-len(s))
+	}
+	return strings.Repeat(string(c), n-len(s)) + string(s)
+}
+
+func registerStrings(global *LocalScope) {
+	builtin := func(name Atomic, params any, fn func(ls *LocalScope, args []any) any) {
+		global.Set(name, builtinFunc(params, fn))
+	}
+	// the result of a builtin, accounted in the string byte quota
+	str := func(ls *LocalScope, s string) RawString {
+		ls.allocate(0, len(s))
+		return RawString(s)
+	}
+
+	builtin("string?", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		_, ok := checkArity(args, 1, 1)[0].(RawString)
+		return Boolean(ok)
+	})
+	builtin("string-length", ConsList[Atomic]("string"), func(ls *LocalScope, args []any) any {
+		return Integer(utf8.RuneCountInString(string(stringOf("string-length", checkArity(args, 1, 1)[0]))))
+	})
+	builtin("string", Atomic("chars"), func(ls *LocalScope, args []any) any {
+		var sb strings.Builder
+		for _, c := range args {
+			sb.WriteRune(rune(charOf("string", c)))
+		}
+		return str(ls, sb.String())
+	})
+	builtin("make-string", ConsListDotted[Atomic]("k", "char"), func(ls *LocalScope, args []any) any {
+		n := indexOf("make-string", checkArity(args, 1, 2)[0], math.MaxInt32)
+		c := ' '
+		if len(args) > 1 {
+			c = rune(charOf("make-string", args[1]))
+		}
+		ls.allocate(0, n*utf8.RuneLen(c))
+		return RawString(strings.Repeat(string(c), n))
+	})
+	builtin("substring", ConsListDotted[Atomic]("string", "start", "end"), func(ls *LocalScope, args []any) any {
+		runes, start, end := runeRange("substring", checkArity(args, 2, 3)[0], args[1:])
+		return str(ls, string(runes[start:end]))
+	})
+	builtin("string-copy", ConsListDotted[Atomic]("string", "start+end"), func(ls *LocalScope, args []any) any {
+		runes, start, end := runeRange("string-copy", checkArity(args, 1, 3)[0], args[1:])
+		return str(ls, string(runes[start:end]))
+	})
+	builtin("string-append", Atomic("strings"), func(ls *LocalScope, args []any) any {
+		var sb strings.Builder
+		for _, s := range args {
+			sb.WriteString(string(stringOf("string-append", s)))
+		}
+		return str(ls, sb.String())
+	})
+
+	conversion := func(name string, conv func(string) string) {
+		builtin(Atomic(name), ConsList[Atomic]("string"), func(ls *LocalScope, args []any) any {
+			return str(ls, conv(string(stringOf(name, checkArity(args, 1, 1)[0]))))
+		})
+	}
+	conversion("string-upcase", upcaseString)
+	conversion("string-downcase", strings.ToLower)
+	conversion("string-foldcase", foldString)
+
+	// (string=? s1 s2 s3 ...) of all the adjacent strings, -ci ones compare the folded case
+	comparison := func(name string, fold bool, holds func(sign int) bool) {
+		builtin(Atomic(name), Cons(Atomic("string1"), Atomic("strings")), func(ls *LocalScope, args []any) any {
+			strs := make([]string, len(checkArity(args, 1, math.MaxInt)))
+			for i, s := range args {
+				if strs[i] = string(stringOf(name, s)); fold {
+					strs[i] = foldString(strs[i])
+				}
+			}
+			for i := 1; i < len(strs); i++ {
+				if !holds(strings.Compare(strs[i-1], strs[i])) { // byte order of UTF-8 is the rune order
+					return False
+				}
+			}
+			return True
+		})
+	}
+	for prefix, ci := range map[string]bool{"string": false, "string-ci": true} {
+		comparison(prefix+"=?", ci, func(sign int) bool { return sign == 0 })
+		comparison(prefix+"<?", ci, func(sign int) bool { return sign < 0 })
+		comparison(prefix+">?", ci, func(sign int) bool { return sign > 0 })
+		comparison(prefix+"<=?", ci, func(sign int) bool { return sign <= 0 })
+		comparison(prefix+">=?", ci, func(sign int) bool { return sign >= 0 })
+	}
+
+	// (string-index s char-or-pred [start end]) is the index of the first match, #f if none
+	builtin("string-index", ConsListDotted[Atomic]("string", "pred", "start+end"), func(ls *LocalScope, args []any) any {
+		runes, start, end := runeRange("string-index", checkArity(args, 2, 4)[0], args[2:])
+		match := runeMatcher(ls, "string-index", args[1])
+		for i := start; i < end; i++ {
+			if match(runes[i]) {
+				return Integer(i)
+			}
+		}
+		return False
+	})
+	// (string-contains s pattern) is the index of the pattern in s, #f if it is not there
+	builtin("string-contains", ConsList[Atomic]("string", "pattern"), func(ls *LocalScope, args []any) any {
+		s := string(stringOf("string-contains", checkArity(args, 2, 2)[0]))
+		if i := strings.Index(s, string(stringOf("string-contains", args[1]))); i >= 0 {
+			return runeIndex(s, i)
+		}
+		return False
+	})
+	// (string-split "a,b" ",") is ("a" "b"), without a delimiter it splits on whitespace
+	builtin("string-split", ConsListDotted[Atomic]("string", "delimiter"), func(ls *LocalScope, args []any) any {
+		s := string(stringOf("string-split", checkArity(args, 1, 2)[0]))
+		var parts []string
+		if len(args) == 1 {
+			parts = strings.Fields(s)
+		} else if c, ok := args[1].(Char); ok {
+			parts = strings.Split(s, string(c))
+		} else {
+			parts = strings.Split(s, string(stringOf("string-split", args[1])))
+		}
+		ls.allocate(len(parts), len(s))
+		res := make([]any, len(parts))
+		for i, p := range parts {
+			res[i] = RawString(p)
+		}
+		return NewArray(res...).list()
+	})
+	// (string-join '("a" "b") ", "), the delimiter is a space by default
+	builtin("string-join", ConsListDotted[Atomic]("list", "delimiter"), func(ls *LocalScope, args []any) any {
+		sep := " "
+		if len(checkArity(args, 1, 2)) > 1 {
+			sep = string(stringOf("string-join", args[1]))
+		}
+		return str(ls, strings.Join(stringList("string-join", args[0]), sep))
+	})
+	// (string-trim s [char-or-pred]) trims whitespace or the matching characters
+	trim := func(name string, trim func(string, func(rune) bool) string) {
+		builtin(Atomic(name), ConsListDotted[Atomic]("string", "pred"), func(ls *LocalScope, args []any) any {
+			s := string(stringOf(name, checkArity(args, 1, 2)[0]))
+			match := unicode.IsSpace
+			if len(args) > 1 {
+				match = runeMatcher(ls, name, args[1])
+			}
+			return str(ls, trim(s, match))
+		})
+	}
+	trim("string-trim", strings.TrimFunc)
+	trim("string-trim-left", strings.TrimLeftFunc)
+	trim("string-trim-right", strings.TrimRightFunc)
+	// (string-pad "7" 3 #\0) is "007": to the length n, padded or cut on the left, -right on the right
+	padding := func(name string, right bool) {
+		builtin(Atomic(name), ConsListDotted[Atomic]("string", "n", "char"), func(ls *LocalScope, args []any) any {
+			s := []rune(string(stringOf(name, checkArity(args, 2, 3)[0])))
+			n := indexOf(name, args[1], math.MaxInt32)
+			c := ' '
+			if len(args) > 2 {
+				c = rune(charOf(name, args[2]))
+			}
+			return str(ls, pad(s, n, c, right))
+		})
+	}
+	padding("string-pad", false)
+	padding("string-pad-right", true)
+	// (string-replace s old new) replaces all the occurrences
+	builtin("string-replace", ConsList[Atomic]("string", "old", "new"), func(ls *LocalScope, args []any) any {
+		s := stringOf("string-replace", checkArity(args, 3, 3)[0])
+		old, repl := stringOf("string-replace", args[1]), stringOf("string-replace", args[2])
+		return str(ls, strings.ReplaceAll(string(s), string(old), string(repl)))
+	})
+
+	builtin("string->list", ConsListDotted[Atomic]("string", "start+end"), func(ls *LocalScope, args []any) any {
+		runes, start, end := runeRange("string->list", checkArity(args, 1, 3)[0], args[1:])
+		chars := make([]any, end-start)
+		for i, r := range runes[start:end] {
+			chars[i] = Char(r)
+		}
+		ls.allocate(len(chars), 0)
+		return NewArray(chars...).list()
+	})
+	builtin("list->string", ConsList[Atomic]("list"), func(ls *LocalScope, args []any) any {
+		elems, ok := listElems(checkArity(args, 1, 1)[0])
+		if !ok {
+			panic(TypeError{fmt.Sprintf("list->string: <%s> is not a list", toStr(args[0]))})
+		}
+		var sb strings.Builder
+		for _, c := range elems {
+			sb.WriteRune(rune(charOf("list->string", c)))
+		}
+		return str(ls, sb.String())
+	})
+	builtin("string->symbol", ConsList[Atomic]("string"), func(ls *LocalScope, args []any) any {
+		return Atomic(stringOf("string->symbol", checkArity(args, 1, 1)[0]))
+	})
+	builtin("symbol->string", ConsList[Atomic]("symbol"), func(ls *LocalScope, args []any) any {
+		sym, ok := checkArity(args, 1, 1)[0].(Atomic)
+		if !ok {
+			panic(TypeError{fmt.Sprintf("symbol->string: <%s> is not a symbol", toStr(args[0]))})
+		}
+		return str(ls, string(stripAlias(sym)))
+	})
+}
+
+// The case mappings of the Unicode character database which give more than one rune,
+// the unconditional ones of SpecialCasing.txt and the full (F) ones of CaseFolding.txt.
+// The other runes map to a single rune as unicode.ToUpper and foldCase do.
+var upperSpecial = map[rune]string{
+	0x00DF: "SS", 0x0149: "ʼN", 0x01F0: "J\u030c", 0x0390: "Ι\u0308\u0301", 0x03B0: "Υ\u0308\u0301",
+	0x0587: "ԵՒ", 0x1E96: "H\u0331", 0x1E97: "T\u0308", 0x1E98: "W\u030a", 0x1E99: "Y\u030a",
+	0x1E9A: "Aʾ", 0x1F50: "Υ\u0313", 0x1F52: "Υ\u0313\u0300", 0x1F54: "Υ\u0313\u0301",
+	0x1F56: "Υ\u0313\u0342", 0x1F80: "ἈΙ", 0x1F81: "ἉΙ", 0x1F82: "ἊΙ", 0x1F83: "ἋΙ", 0x1F84: "ἌΙ",
+	0x1F85: "ἍΙ", 0x1F86: "ἎΙ", 0x1F87: "ἏΙ", 0x1F88: "ἈΙ", 0x1F89: "ἉΙ", 0x1F8A: "ἊΙ", 0x1F8B: "ἋΙ",
+	0x1F8C: "ἌΙ", 0x1F8D: "ἍΙ", 0x1F8E: "ἎΙ", 0x1F8F: "ἏΙ", 0x1F90: "ἨΙ", 0x1F91: "ἩΙ", 0x1F92: "ἪΙ",
+	0x1F93: "ἫΙ", 0x1F94: "ἬΙ", 0x1F95: "ἭΙ", 0x1F96: "ἮΙ", 0x1F97: "ἯΙ", 0x1F98: "ἨΙ", 0x1F99: "ἩΙ",
+	0x1F9A: "ἪΙ", 0x1F9B: "ἫΙ", 0x1F9C: "ἬΙ", 0x1F9D: "ἭΙ", 0x1F9E: "ἮΙ", 0x1F9F: "ἯΙ", 0x1FA0: "ὨΙ",
+	0x1FA1: "ὩΙ", 0x1FA2: "ὪΙ", 0x1FA3: "ὫΙ", 0x1FA4: "ὬΙ", 0x1FA5: "ὭΙ", 0x1FA6: "ὮΙ", 0x1FA7: "ὯΙ",
+	0x1FA8: "ὨΙ", 0x1FA9: "ὩΙ", 0x1FAA: "ὪΙ", 0x1FAB: "ὫΙ", 0x1FAC: "ὬΙ", 0x1FAD: "ὭΙ", 0x1FAE: "ὮΙ",
+	0x1FAF: "ὯΙ", 0x1FB2: "ᾺΙ", 0x1FB3: "ΑΙ", 0x1FB4: "ΆΙ", 0x1FB6: "Α\u0342", 0x1FB7: "Α\u0342Ι",
+	0x1FBC: "ΑΙ", 0x1FC2: "ῊΙ", 0x1FC3: "ΗΙ", 0x1FC4: "ΉΙ", 0x1FC6: "Η\u0342", 0x1FC7: "Η\u0342Ι",
+	0x1FCC: "ΗΙ", 0x1FD2: "Ι\u0308\u0300", 0x1FD3: "Ι\u0308\u0301", 0x1FD6: "Ι\u0342",
+	0x1FD7: "Ι\u0308\u0342", 0x1FE2: "Υ\u0308\u0300", 0x1FE3: "Υ\u0308\u0301", 0x1FE4: "Ρ\u0313",
+	0x1FE6: "Υ\u0342", 0x1FE7: "Υ\u0308\u0342", 0x1FF2: "ῺΙ", 0x1FF3: "ΩΙ", 0x1FF4: "ΏΙ",
+	0x1FF6: "Ω\u0342", 0x1FF7: "Ω\u0342Ι", 0x1FFC: "ΩΙ", 0xFB00: "FF", 0xFB01: "FI", 0xFB02: "FL",
+	0xFB03: "FFI", 0xFB04: "FFL", 0xFB05: "ST", 0xFB06: "ST", 0xFB13: "ՄՆ", 0xFB14: "ՄԵ",
+	0xFB15: "ՄԻ", 0xFB16: "ՎՆ", 0xFB17: "ՄԽ",
+}
+
+var foldSpecial = map[rune]string{
+	0x00DF: "ss", 0x0130: "i\u0307", 0x0149: "ʼn", 0x01F0: "j\u030c", 0x0390: "ι\u0308\u0301",
+	0x03B0: "υ\u0308\u0301", 0x0587: "եւ", 0x1E96: "h\u0331", 0x1E97: "t\u0308", 0x1E98: "w\u030a",
+	0x1E99: "y\u030a", 0x1E9A: "aʾ", 0x1E9E: "ss", 0x1F50: "υ\u0313", 0x1F52: "υ\u0313\u0300",
+	0x1F54: "υ\u0313\u0301", 0x1F56: "υ\u0313\u0342", 0x1F80: "ἀι", 0x1F81: "ἁι", 0x1F82: "ἂι",
+	0x1F83: "ἃι", 0x1F84: "ἄι", 0x1F85: "ἅι", 0x1F86: "ἆι", 0x1F87: "ἇι", 0x1F88: "ἀι", 0x1F89: "ἁι",
+	0x1F8A: "ἂι", 0x1F8B: "ἃι", 0x1F8C: "ἄι", 0x1F8D: "ἅι", 0x1F8E: "ἆι", 0x1F8F: "ἇι", 0x1F90: "ἠι",
+	0x1F91: "ἡι", 0x1F92: "ἢι", 0x1F93: "ἣι", 0x1F94: "ἤι", 0x1F95: "ἥι", 0x1F96: "ἦι", 0x1F97: "ἧι",
+	0x1F98: "ἠι", 0x1F99: "ἡι", 0x1F9A: "ἢι", 0x1F9B: "ἣι", 0x1F9C: "ἤι", 0x1F9D: "ἥι", 0x1F9E: "ἦι",
+	0x1F9F: "ἧι", 0x1FA0: "ὠι", 0x1FA1: "ὡι", 0x1FA2: "ὢι", 0x1FA3: "ὣι", 0x1FA4: "ὤι", 0x1FA5: "ὥι",
+	0x1FA6: "ὦι", 0x1FA7: "ὧι", 0x1FA8: "ὠι", 0x1FA9: "ὡι", 0x1FAA: "ὢι", 0x1FAB: "ὣι", 0x1FAC: "ὤι",
+	0x1FAD: "ὥι", 0x1FAE: "ὦι", 0x1FAF: "ὧι", 0x1FB2: "ὰι", 0x1FB3: "αι", 0x1FB4: "άι",
+	0x1FB6: "α\u0342", 0x1FB7: "α\u0342ι", 0x1FBC: "αι", 0x1FC2: "ὴι", 0x1FC3: "ηι", 0x1FC4: "ήι",
+	0x1FC6: "η\u0342", 0x1FC7: "η\u0342ι", 0x1FCC: "ηι", 0x1FD2: "ι\u0308\u0300",
+	0x1FD3: "ι\u0308\u0301", 0x1FD6: "ι\u0342", 0x1FD7: "ι\u0308\u0342", 0x1FE2: "υ\u0308\u0300",
+	0x1FE3: "υ\u0308\u0301", 0x1FE4: "ρ\u0313", 0x1FE6: "υ\u0342", 0x1FE7: "υ\u0308\u0342",
+	0x1FF2: "ὼι", 0x1FF3: "ωι", 0x1FF4: "ώι", 0x1FF6: "ω\u0342", 0x1FF7: "ω\u0342ι", 0x1FFC: "ωι",
+	0xFB00: "ff", 0xFB01: "fi", 0xFB02: "fl", 0xFB03: "ffi", 0xFB04: "ffl", 0xFB05: "st",
+	0xFB06: "st", 0xFB13: "մն", 0xFB14: "մե", 0xFB15: "մի", 0xFB16: "վն", 0xFB17: "մխ",
+}
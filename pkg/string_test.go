@@ -0,0 +1,49 @@
+package lisp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_strings(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+
+	for _, test := range []struct{ code, expected string }{
+		{`(list (string-length "héllo🙂") (strlen "héllo🙂") (string? "a") (string? #\a))`, `(6 10 #t #f)`},
+		{`(list (substring "héllo" 1 3) (substring "héllo" 2) (string-copy "añb" 1 2))`, `("él" "llo" "ñ")`},
+		{`(list (string-append "a" "ñ" "") (string #\a #\λ) (make-string 3 #\ж) (string-append))`, `("añ" "aλ" "жжж" "")`},
+		{`(list (string-upcase "héllo") (string-downcase "ÀB") (string-foldcase "ΣAb"))`, `("HÉLLO" "àb" "σab")`},
+		{`(list (string=? "a" "a" "a") (string<? "a" "b" "c") (string<? "b" "a") (string>=? "b" "b" "a"))`, `(#t #t #f #t)`},
+		{`(list (string-ci=? "Hello" "hELLO") (string-ci<? "a" "B") (string=? "a" "A"))`, `(#t #t #f)`},
+		{`(list (string-upcase "straße") (string-foldcase "Straße ﬁn") (string-ci=? "straße" "STRASSE" "STRAẞE"))`, `("STRASSE" "strasse fin" #t)`},
+		{`(list (string-ci<? "straße" "strasse") (string-ci>? "STRASSE" "straße") (string-length (string-upcase "ǰ")))`, `(#f #f 2)`},
+		{`(list (string-index "añb c" #\b) (string-index "añb c" char-whitespace?) (string-index "abc" #\z))`, `(2 3 #f)`},
+		{`(list (string-index "abcabc" #\a 1) (string-contains "añbañc" "ñc") (string-contains "abc" "x"))`, `(3 4 #f)`},
+		{`(list (string-split "a,b,,c" ",") (string-split "  one two\tthree ") (string-split "a b" #\space))`, `(("a" "b" "" "c") ("one" "two" "three") ("a" "b"))`},
+		{`(list (string-join '("a" "b" "c") ", ") (string-join '("a" "b")) (string-join '()))`, `("a, b, c" "a b" "")`},
+		{`(list (string-trim "  a b \n") (string-trim-left "  a ") (string-trim-right "  a ") (string-trim "xxaxx" #\x))`, `("a b" "a " "  a" "a")`},
+		{`(list (string-pad "7" 3 #\0) (string-pad "12345" 3) (string-pad-right "ñ" 3 #\.) (string-pad-right "12345" 2))`, `("007" "345" "ñ.." "12")`},
+		{`(string-replace "a-b-c" "-" "+")`, `"a+b+c"`},
+		{`(list (string->list "añ") (string->list "abcd" 1 3) (list->string (list #\ñ #\o)))`, `((#\a #\ñ) (#\b #\c) "ño")`},
+		{`(list (string->symbol "abc") (symbol->string 'xyz) (eq? (string->symbol "q") 'q))`, `(abc "xyz" #t)`},
+		{`(let ((h (make-hash-table string=?))) (hash-table-set! h "k" 1) (hash-table-ref/default h "k" 0))`, `1`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	for _, code := range []string{`(string-length 'a)`, `(string-append "a" 1)`, `(string-index "a" 1)`, `(string-join '("a" 1))`} {
+		_, err := interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(TypeError), code)
+	}
+	_, err := interp.EvalString(ctx, `(substring "añb" 2 4)`)
+	assert.ErrorAs(t, err, new(ExecError))
+
+	limited := New(WithLimits(Limits{MaxStringBytes: 100}))
+	_, err = limited.EvalString(ctx, `(define (grow s) (grow (string-append s "ab"))) (grow "")`)
+	assert.ErrorAs(t, err, new(LimitError))
+}
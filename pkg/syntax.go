@@ -0,0 +1,472 @@
+package lisp
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Hygienic macros: (define-syntax name (syntax-rules (literal ...) (pattern template) ...)).
+//
+// Every identifier a template inserts, except the pattern variables, is renamed
+// to a fresh alias like `tmp·3.12`, which can not clash with the identifiers of the
+// user code: binding forms of the expansion bind the alias itself, and a free
+// alias is looked up as the original identifier in the scope the macro was
+// defined in. `quote` turns aliases back into the original symbols.
+//
+// The alias carries the renamed identifier and the number of the macro environment (3),
+// a scope which the expansion is evaluated in or below: the free alias is looked up in
+// the closest scope of that number, so nothing is kept for an expansion or a macro
+// environment. The last number makes the alias fresh.
+
+type alias struct {
+	name Atomic      // the identifier of the template
+	env  *LocalScope // the macro was defined in
+}
+
+const aliasMark = "·" // the reader does not accept it in identifiers
+
+// the number of the macro environment, the same for all the views of the scope
+func macroEnvID(env *LocalScope) int {
+	if id := env.mu.macroID.Load(); id != 0 {
+		return int(id)
+	}
+	env.mu.macroID.CompareAndSwap(0, env.Interpreter().aliasCnt.Add(1))
+	return int(env.mu.macroID.Load())
+}
+
+func (sr *syntaxRules) rename(name Atomic) Atomic {
+	fresh := sr.env.Interpreter().aliasCnt.Add(1)
+	return Atomic(fmt.Sprintf("%s%s%d.%d", string(name), aliasMark, sr.envID, fresh))
+}
+
+// the renamed identifier and the macro environment number of the alias
+func splitAlias(a Atomic) (Atomic, int, bool) {
+	i := strings.LastIndex(string(a), aliasMark)
+	if i < 0 {
+		return "", 0, false
+	}
+	id, fresh, ok := strings.Cut(string(a[i+len(aliasMark):]), ".")
+	n, err := strconv.Atoi(id)
+	if !ok || err != nil || !isDigits(fresh, 10) {
+		return "", 0, false
+	}
+	return a[:i], n, true
+}
+
+func aliasOf(ctx *LocalScope, a Atomic) (alias, bool) {
+	name, id, ok := splitAlias(a)
+	if !ok {
+		return alias{}, false
+	}
+	for env := ctx; env != nil; env = env.parent {
+		if env.mu.macroID.Load() == int64(id) {
+			return alias{name, env}, true
+		}
+	}
+	return alias{}, false
+}
+
+// the identifier written in the source the alias comes from
+func stripAlias(a Atomic) Atomic {
+	for {
+		name, _, ok := splitAlias(a)
+		if !ok {
+			return a
+		}
+		a = name
+	}
+}
+
+// the datum with aliases replaced by their original symbols, v itself if there are none
+func syntaxToDatum(v any) any {
+	switch v := v.(type) {
+	case Atomic:
+		return stripAlias(v)
+	case *ConsCell:
+		if v == nil {
+			return v
+		}
+		car, cdr := syntaxToDatum(v.car), syntaxToDatum(v.cdr)
+		if car == v.car && cdr == v.cdr {
+			return v
+		}
+		return Cons(car, cdr)
+	case *Array:
+		elems := make([]any, len(v.storage))
+		changed := false
+		for i, e := range v.storage {
+			elems[i] = syntaxToDatum(e)
+			changed = changed || elems[i] != e
+		}
+		if changed {
+			return NewArray(elems...)
+		}
+	}
+	return v
+}
+
+type (
+	syntaxRules struct {
+		ellipsis Atomic
+		literals []Atomic
+		rules    []syntaxRule
+		env      *LocalScope
+		envID    int // of env, see alias
+	}
+
+	syntaxRule struct{ pattern, template any } // pattern without the macro keyword
+
+	// the forms matched by a pattern variable followed by an ellipsis
+	ellipsisMatch []any
+)
+
+// (syntax-rules [ellipsis] (literal ...) (pattern template) ...)
+func SyntaxRules(env *LocalScope, spec Pair) *Func {
+	sr := &syntaxRules{ellipsis: "...", env: env, envID: macroEnvID(env)}
+	if e, ok := spec.Car().(Atomic); ok {
+		sr.ellipsis = stripAlias(e)
+		spec = PairOf(spec.Cdr())
+	}
+	if IsEmptyList(spec) {
+		panic(SyntaxError{"syntax-rules: literals expected"})
+	}
+	literals, ok := listElems(spec.Car())
+	if !ok {
+		panic(SyntaxError{"syntax-rules: literals expected"})
+	}
+	for _, l := range literals {
+		sr.literals = append(sr.literals, stripAlias(l.(Atomic)))
+	}
+	rules, ok := listElems(spec.Cdr())
+	if !ok {
+		panic(SyntaxError{"syntax-rules: rules expected"})
+	}
+	for _, r := range rules {
+		rule, ok := listElems(r)
+		if !ok || len(rule) != 2 || !IsCons(rule[0]) || IsNil(rule[0]) {
+			panic(SyntaxError{"syntax-rules: (pattern template) expected, got " + toStr(r)})
+		}
+		sr.rules = append(sr.rules, syntaxRule{rule[0].(*ConsCell).cdr, rule[1]})
+	}
+
+	f := &Func{macro: true, args: ExprOfAny(Atomic("form"))}
+	f.expand = func(callCtx *LocalScope, args Pair) any {
+		return sr.expand(f.name, args)
+	}
+	f.fn = expanding(f)
+	return f
+}
+
+func (sr *syntaxRules) expand(name string, args Pair) any {
+	for _, rule := range sr.rules {
+		b := make(map[Atomic]any)
+		if sr.match(rule.pattern, args, b) {
+			return sr.instantiate(rule.template, b, make(map[Atomic]Atomic))
+		}
+	}
+	panic(SyntaxError{fmt.Sprintf("no syntax rule matches %s", Cons(Atomic(name), args))})
+}
+
+// identifiers of the rules may be aliases when the macro is defined by a macro
+func (sr *syntaxRules) isLiteral(a Atomic) bool {
+	a = stripAlias(a)
+	for _, l := range sr.literals {
+		if l == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (sr *syntaxRules) isEllipsis(v any) bool {
+	a, ok := v.(Atomic)
+	return ok && stripAlias(a) == sr.ellipsis
+}
+
+func (sr *syntaxRules) match(pat, form any, b map[Atomic]any) bool {
+	switch p := pat.(type) {
+	case Atomic:
+		if stripAlias(p) == "_" {
+			return true
+		} else if sr.isLiteral(p) {
+			a, ok := form.(Atomic)
+			return ok && stripAlias(a) == stripAlias(p)
+		}
+		b[p] = form
+		return true
+	case *ConsCell:
+		if p == nil {
+			return IsEmptyList(form)
+		}
+		if sr.hasEllipsis(p) {
+			return sr.matchEllipsis(p, form, b)
+		}
+		f, ok := form.(*ConsCell)
+		return ok && f != nil && sr.match(p.car, f.car, b) && sr.match(p.cdr, f.cdr, b)
+	case *Array: // as the list of the elements
+		f, ok := form.(*Array)
+		return ok && sr.match(p.list(), f.list(), b)
+	case nil:
+		return IsEmptyList(form)
+	default:
+		return reflect.DeepEqual(pat, form)
+	}
+}
+
+func (sr *syntaxRules) hasEllipsis(p *ConsCell) bool {
+	for ; p != nil; p, _ = p.cdr.(*ConsCell) {
+		if sr.isEllipsis(p.car) {
+			return true
+		}
+	}
+	return false
+}
+
+// (before ... repeated <ellipsis> after ... . tail)
+func (sr *syntaxRules) matchEllipsis(p *ConsCell, form any, b map[Atomic]any) bool {
+	var pats []any
+	var ptail any
+	for c := p; ; {
+		pats = append(pats, c.car)
+		next, ok := c.cdr.(*ConsCell)
+		if !ok || next == nil {
+			ptail = c.cdr
+			break
+		}
+		c = next
+	}
+	k := 0
+	for !sr.isEllipsis(pats[k]) {
+		k++
+	}
+	if k == 0 {
+		panic(SyntaxError{"syntax-rules: ellipsis without a pattern"})
+	}
+	before, repeated, after := pats[:k-1], pats[k-1], pats[k+1:]
+
+	var forms []any
+	ftail := form
+	for {
+		f, ok := ftail.(*ConsCell)
+		if !ok || f == nil {
+			break
+		}
+		forms = append(forms, f.car)
+		ftail = f.cdr
+	}
+	reps := len(forms) - len(before) - len(after)
+	if reps < 0 || IsEmptyList(ptail) && !IsEmptyList(ftail) {
+		return false
+	}
+
+	for i, bp := range before {
+		if !sr.match(bp, forms[i], b) {
+			return false
+		}
+	}
+	vars := sr.patternVars(repeated, nil)
+	seqs := make(map[Atomic]ellipsisMatch, len(vars))
+	for _, f := range forms[len(before) : len(before)+reps] {
+		rb := make(map[Atomic]any)
+		if !sr.match(repeated, f, rb) {
+			return false
+		}
+		for _, v := range vars {
+			seqs[v] = append(seqs[v], rb[v])
+		}
+	}
+	for _, v := range vars {
+		b[v] = seqs[v]
+	}
+	for i, ap := range after {
+		if !sr.match(ap, forms[len(before)+reps+i], b) {
+			return false
+		}
+	}
+	if !IsEmptyList(ptail) {
+		return sr.match(ptail, ftail, b)
+	}
+	return true
+}
+
+func (sr *syntaxRules) patternVars(pat any, res []Atomic) []Atomic {
+	switch p := pat.(type) {
+	case Atomic:
+		if stripAlias(p) != "_" && !sr.isLiteral(p) && !sr.isEllipsis(p) {
+			res = append(res, p)
+		}
+	case *ConsCell:
+		if p != nil {
+			res = sr.patternVars(p.cdr, sr.patternVars(p.car, res))
+		}
+	case *Array:
+		res = sr.patternVars(p.list(), res)
+	}
+	return res
+}
+
+// the template with the pattern variables substituted and the other identifiers renamed
+func (sr *syntaxRules) instantiate(tmpl any, b map[Atomic]any, renamed map[Atomic]Atomic) any {
+	switch t := tmpl.(type) {
+	case Atomic:
+		if v, ok := b[t]; ok {
+			if _, ok := v.(ellipsisMatch); ok {
+				panic(SyntaxError{fmt.Sprintf("syntax-rules: pattern variable %s is used without an ellipsis", t)})
+			}
+			return v
+		}
+		if a, ok := renamed[t]; ok {
+			return a
+		}
+		a := sr.rename(t)
+		renamed[t] = a
+		return a
+	case *ConsCell:
+		if t == nil {
+			return t
+		}
+		if sr.isEllipsis(t.car) { // (... template) escapes the ellipsis
+			if rest, ok := t.cdr.(*ConsCell); ok && rest != nil {
+				escaped := *sr
+				escaped.ellipsis = ""
+				return escaped.instantiate(rest.car, b, renamed)
+			}
+		}
+		last, depth := t, 0 // the last ellipsis following the subtemplate
+		for {
+			next, ok := last.cdr.(*ConsCell)
+			if !ok || next == nil || !sr.isEllipsis(next.car) {
+				break
+			}
+			last, depth = next, depth+1
+		}
+		if depth == 0 {
+			return Cons(sr.instantiate(t.car, b, renamed), sr.instantiate(t.cdr, b, renamed))
+		}
+		bindings := []map[Atomic]any{b}
+		for range depth {
+			var unrolled []map[Atomic]any
+			for _, eb := range bindings {
+				unrolled = append(unrolled, sr.unroll(t.car, eb)...)
+			}
+			bindings = unrolled
+		}
+		res := sr.instantiate(last.cdr, b, renamed)
+		for i := len(bindings) - 1; i >= 0; i-- {
+			res = Cons(sr.instantiate(t.car, bindings[i], renamed), res)
+		}
+		return res
+	case *Array:
+		elems, _ := listElems(sr.instantiate(t.list(), b, renamed))
+		return NewArray(elems...)
+	case Quasiquoted:
+		return Quasiquoted{sr.instantiate(t.boxed, b, renamed)}
+	case Unquoted:
+		return Unquoted{sr.instantiate(t.boxed, b, renamed)}
+	case UnquotedSpliced:
+		return UnquotedSpliced{sr.instantiate(t.boxed, b, renamed)}
+	}
+	return tmpl
+}
+
+// the bindings for every repetition of the subtemplate followed by an ellipsis
+func (sr *syntaxRules) unroll(tmpl any, b map[Atomic]any) []map[Atomic]any {
+	n := -1
+	var vars []Atomic
+	for _, v := range sr.patternVars(tmpl, nil) {
+		if m, ok := b[v].(ellipsisMatch); ok {
+			if n >= 0 && len(m) != n {
+				panic(SyntaxError{"syntax-rules: pattern variables of an ellipsis matched different numbers of forms"})
+			}
+			n = len(m)
+			vars = append(vars, v)
+		}
+	}
+	if n < 0 {
+		panic(SyntaxError{fmt.Sprintf("syntax-rules: no pattern variable to repeat in %s", toStr(tmpl))})
+	}
+	res := make([]map[Atomic]any, n)
+	for i := range res {
+		res[i] = make(map[Atomic]any, len(b))
+		for k, v := range b {
+			res[i][k] = v
+		}
+		for _, v := range vars {
+			res[i][v] = b[v].(ellipsisMatch)[i]
+		}
+	}
+	return res
+}
+
+// (let-syntax ((name transformer) ...) body ...), transformers of letrec-syntax see each other
+func letSyntax(ctx *LocalScope, p Pair, rec bool) any {
+	bindings, ok := listElems(p.Car())
+	if !ok {
+		panic(SyntaxError{"let-syntax: bindings expected"})
+	}
+	bodyCtx := ctx.Sub()
+	defCtx := ctx
+	if rec {
+		defCtx = bodyCtx
+	}
+	for _, binding := range bindings {
+		parts, ok := listElems(binding)
+		if !ok || len(parts) != 2 {
+			panic(SyntaxError{"let-syntax: (name transformer) expected"})
+		}
+		name := parts[0].(Atomic)
+		bodyCtx.Set(name, transformer(defCtx, name, parts[1]))
+	}
+	var es []Expr
+	for code := PairOf(p.Cdr()); !IsEmptyList(code); code = PairOf(code.Cdr()) {
+		es = append(es, ExprOfAny(code.Car()))
+	}
+	return execBody(bodyCtx, es)
+}
+
+func transformer(ctx *LocalScope, name Atomic, spec any) *Func {
+	f, ok := ExprOfAny(spec).Exec(ctx).(*Func)
+	if !ok || !f.macro {
+		panic(SyntaxError{fmt.Sprintf("%s: syntax transformer expected", name)})
+	}
+	if f.name == "" {
+		f.name = string(name)
+	}
+	return f
+}
+
+func registerSyntax(global *LocalScope) {
+	global.Set("syntax-rules", &Func{
+		macro: true,
+		args:  ExprOfAny(Cons(Atomic("literals"), Atomic("rules"))),
+		fn: func(ls *LocalScope, p Pair) any {
+			return SyntaxRules(ls, p)
+		},
+	})
+	global.Set("define-syntax", &Func{
+		macro: true,
+		args:  ExprOfAny(ConsList[Atomic]("name", "transformer")),
+		fn: func(ls *LocalScope, p Pair) any {
+			name := p.Car().(Atomic)
+			ls.checkWritable("define-syntax", name)
+			ls.Set(name, transformer(ls, name, p.Cdr().(Pair).Car()))
+			return nil
+		},
+	})
+	global.Set("let-syntax", &Func{
+		macro: true,
+		args:  ExprOfAny(Cons(Atomic("bindings"), Atomic("body"))),
+		fn: func(ls *LocalScope, p Pair) any {
+			return letSyntax(ls, p, false)
+		},
+	})
+	global.Set("letrec-syntax", &Func{
+		macro: true,
+		args:  ExprOfAny(Cons(Atomic("bindings"), Atomic("body"))),
+		fn: func(ls *LocalScope, p Pair) any {
+			return letSyntax(ls, p, true)
+		},
+	})
+}
@@ -20,7 +20,22 @@ func IsNilValue(v any) bool {
 	}
 }
 
-func TypeOf(v any) string { return reflect.TypeOf(v).String() }
+// truthiness used by `if`: Boolable decides for itself, any other non-nil value is true
+func IsTrue(v any) bool {
+	if b, ok := v.(Boolable); ok {
+		return b.Bool()
+	}
+	return v != nil
+}
+
+func TypeOf(v any) string {
+	if o, ok := v.(*GoObject); ok {
+		return "go " + o.value.Type().String()
+	} else if r, ok := v.(*Record); ok {
+		return "record " + r.rtype.name
+	}
+	return reflect.TypeOf(v).String()
+}
 
 func PairOf(v any) Pair {
 	if v == nil {
@@ -167,3 +182,24 @@ func InsertInplace(where, what *ConsCell) *ConsCell { // where.car := expand(wha
 func Insert(where, what *ConsCell) *ConsCell {
 	return InsertInplace(DeepcopyCons(where), what)
 }
+
+// a native procedure getting its arguments as a slice
+func builtinFunc(params any, fn func(ls *LocalScope, args []any) any) *Func {
+	return &Func{
+		args: ExprOfAny(params),
+		fn: func(ls *LocalScope, p Pair) any {
+			args, _ := listElems(p)
+			return fn(ls, args)
+		},
+	}
+}
+
+// the arguments if there are at least min and at most max of them
+func checkArity(args []any, min, max int) []any {
+	if len(args) > max {
+		panic(TooManyArguments)
+	} else if len(args) < min {
+		panic(TooFewArguments)
+	}
+	return args
+}
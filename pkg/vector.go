@@ -0,0 +1,191 @@
+package lisp
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Array is a vector: #(1 2 3) or [1 2 3], the literals are self-evaluating
+type Array struct{ storage []any }
+
+// NewArray makes a vector of the elements, the slice is not copied
+func NewArray(elems ...any) *Array { return &Array{elems} }
+
+func (a *Array) Len() int             { return len(a.storage) }
+func (a *Array) Elems() []any         { return a.storage }
+func (a *Array) Exec(*LocalScope) any { return a }
+func (a *Array) Bool() bool           { return true }
+
+func (a *Array) String() string { return writeString(a) }
+
+func (a *Array) list() any {
+	if len(a.storage) == 0 {
+		return EmptyList
+	}
+	return ConsList(a.storage...)
+}
+
+func vectorOf(name string, v any) *Array {
+	a, ok := v.(*Array)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("%s: <%s> of type <%s> is not a vector", name, toStr(v), TypeOf(v))})
+	}
+	return a
+}
+
+// the index in [0, limit]
+func indexOf(name string, v any, limit int) int {
+	n, ok := v.(Integer)
+	if !ok {
+		panic(TypeError{fmt.Sprintf("%s: <%s> is not an index", name, toStr(v))})
+	} else if n < 0 || n > Integer(limit) {
+		panic(ExecError{fmt.Sprintf("%s: index %s is out of range [0, %d]", name, n, limit)})
+	}
+	return int(n)
+}
+
+// the [start, end) range of the optional arguments, the whole vector or string by default
+func sliceRange(name string, length int, args []any) (int, int) {
+	start, end := 0, length
+	if len(args) > 2 {
+		panic(TooManyArguments)
+	}
+	if len(args) > 0 {
+		start = indexOf(name, args[0], end)
+	}
+	if len(args) > 1 {
+		end = indexOf(name, args[1], end)
+	}
+	if start > end {
+		panic(ExecError{fmt.Sprintf("%s: start %d is after end %d", name, start, end)})
+	}
+	return start, end
+}
+
+// the elements of the vectors at i, while all of them have one
+func vectorsAt(vs []*Array, i int) (Pair, bool) {
+	args := make([]any, len(vs))
+	for j, v := range vs {
+		if i >= len(v.storage) {
+			return nil, false
+		}
+		args[j] = v.storage[i]
+	}
+	return ConsList(args...), true
+}
+
+func registerVectors(global *LocalScope) {
+	builtin := func(name Atomic, params any, fn func(ls *LocalScope, args []any) any) {
+		global.Set(name, builtinFunc(params, fn))
+	}
+	// (proc vector1 vector2 ...)
+	procAndVectors := func(name string, args []any) (*Func, []*Array) {
+		checkArity(args, 2, math.MaxInt)
+		proc, ok := args[0].(*Func)
+		if !ok {
+			panic(TypeError{fmt.Sprintf("%s: <%s> is not a procedure", name, toStr(args[0]))})
+		}
+		var vs []*Array
+		for _, v := range args[1:] {
+			vs = append(vs, vectorOf(name, v))
+		}
+		return proc, vs
+	}
+
+	builtin("vector?", ConsList[Atomic]("obj"), func(ls *LocalScope, args []any) any {
+		_, ok := checkArity(args, 1, 1)[0].(*Array)
+		return Boolean(ok)
+	})
+	builtin("vector", Atomic("elems"), func(ls *LocalScope, args []any) any {
+		ls.allocate(len(args), 0)
+		return NewArray(slices.Clone(args)...)
+	})
+	builtin("make-vector", ConsListDotted[Atomic]("k", "fill"), func(ls *LocalScope, args []any) any {
+		checkArity(args, 1, 2)
+		n := indexOf("make-vector", args[0], math.MaxInt32)
+		var fill any = False
+		if len(args) > 1 {
+			fill = args[1]
+		}
+		ls.allocate(n, 0)
+		elems := make([]any, n)
+		for i := range elems {
+			elems[i] = fill
+		}
+		return NewArray(elems...)
+	})
+	builtin("vector-length", ConsList[Atomic]("vector"), func(ls *LocalScope, args []any) any {
+		return Integer(vectorOf("vector-length", checkArity(args, 1, 1)[0]).Len())
+	})
+	builtin("vector-ref", ConsList[Atomic]("vector", "k"), func(ls *LocalScope, args []any) any {
+		a := vectorOf("vector-ref", checkArity(args, 2, 2)[0])
+		return a.storage[indexOf("vector-ref", args[1], a.Len()-1)]
+	})
+	builtin("vector-set!", ConsList[Atomic]("vector", "k", "obj"), func(ls *LocalScope, args []any) any {
+		a := vectorOf("vector-set!", checkArity(args, 3, 3)[0])
+		a.storage[indexOf("vector-set!", args[1], a.Len()-1)] = args[2]
+		return nil
+	})
+	builtin("vector-fill!", ConsListDotted[Atomic]("vector", "fill", "start+end"), func(ls *LocalScope, args []any) any {
+		a := vectorOf("vector-fill!", checkArity(args, 2, 4)[0])
+		start, end := sliceRange("vector-fill!", a.Len(), args[2:])
+		for i := start; i < end; i++ {
+			a.storage[i] = args[1]
+		}
+		return nil
+	})
+	builtin("vector-copy", ConsListDotted[Atomic]("vector", "start+end"), func(ls *LocalScope, args []any) any {
+		a := vectorOf("vector-copy", checkArity(args, 1, 3)[0])
+		start, end := sliceRange("vector-copy", a.Len(), args[1:])
+		ls.allocate(end-start, 0)
+		return NewArray(slices.Clone(a.storage[start:end])...)
+	})
+	builtin("vector-append", Atomic("vectors"), func(ls *LocalScope, args []any) any {
+		var elems []any
+		for _, v := range args {
+			elems = append(elems, vectorOf("vector-append", v).storage...)
+		}
+		ls.allocate(len(elems), 0)
+		return NewArray(elems...)
+	})
+	builtin("vector->list", ConsListDotted[Atomic]("vector", "start+end"), func(ls *LocalScope, args []any) any {
+		a := vectorOf("vector->list", checkArity(args, 1, 3)[0])
+		start, end := sliceRange("vector->list", a.Len(), args[1:])
+		ls.allocate(end-start, 0)
+		return NewArray(a.storage[start:end]...).list()
+	})
+	builtin("list->vector", ConsList[Atomic]("list"), func(ls *LocalScope, args []any) any {
+		elems, ok := listElems(checkArity(args, 1, 1)[0])
+		if !ok {
+			panic(TypeError{fmt.Sprintf("list->vector: <%s> is not a list", toStr(args[0]))})
+		}
+		ls.allocate(len(elems), 0)
+		return NewArray(elems...)
+	})
+	// (vector-map proc vector1 vector2 ...), up to the shortest vector
+	builtin("vector-map", ConsListDotted[Atomic]("proc", "vector", "vectors"), func(ls *LocalScope, args []any) any {
+		proc, vs := procAndVectors("vector-map", args)
+		var res []any
+		for i := 0; ; i++ {
+			elems, ok := vectorsAt(vs, i)
+			if !ok {
+				break
+			}
+			res = append(res, proc.Call(ls, elems))
+		}
+		ls.allocate(len(res), 0)
+		return NewArray(res...)
+	})
+	builtin("vector-for-each", ConsListDotted[Atomic]("proc", "vector", "vectors"), func(ls *LocalScope, args []any) any {
+		proc, vs := procAndVectors("vector-for-each", args)
+		for i := 0; ; i++ {
+			elems, ok := vectorsAt(vs, i)
+			if !ok {
+				break
+			}
+			proc.Call(ls, elems)
+		}
+		return nil
+	})
+}
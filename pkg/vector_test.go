@@ -0,0 +1,60 @@
+package lisp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_vectors(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+	_, err := interp.EvalString(ctx, `
+		(define v (vector 1 2 3))
+		(define-syntax first-of
+			(syntax-rules ()
+				((_ #(a b ...)) 'a)))
+		(define-syntax rotate-vector
+			(syntax-rules ()
+				((_ #(a b ...)) #(b ... a))))`)
+	assert.NoError(t, err)
+
+	for _, test := range []struct{ code, expected string }{
+		{`#(1 a "s" (b c))`, `#(1 a "s" (b c))`},
+		{`[1 (+ 1 2)]`, `#(1 (+ 1 2))`},
+		{`(list (vector? v) (vector? '(1)) (vector-length v) (vector-ref v 2))`, `(#t #f 3 3)`},
+		{`(vector-set! v 0 'x) v`, `#(x 2 3)`},
+		{`(make-vector 2 'a)`, `#(a a)`},
+		{`(let ((w (make-vector 4 0))) (vector-fill! w 7 1 3) w)`, `#(0 7 7 0)`},
+		{`(vector-copy #(1 2 3 4) 1)`, `#(2 3 4)`},
+		{`(vector->list #(1 2 3 4) 1 3)`, `(2 3)`},
+		{`(vector->list #())`, `()`},
+		{`(list->vector '(1 2))`, `#(1 2)`},
+		{`(vector-append #(1) #() #(2 3))`, `#(1 2 3)`},
+		{`(vector-map + #(1 2 3) #(10 20))`, `#(11 22)`},
+		{`(define sum 0) (vector-for-each (lambda (x) (set! sum (+ sum x))) #(1 2 3)) sum`, `6`},
+		{`(equal? #(1 (2)) (vector 1 (list 2)))`, `#t`},
+		{"(define y 5) `#(1 ,y ,@(list 6 7))", `#(1 5 6 7)`},
+		{`(first-of #(p q r))`, `p`},
+		{`(rotate-vector #(p q r))`, `#(q r p)`},
+		{`(let ((c (vector-copy v))) (vector-set! c 0 0) (list c v))`, `(#(0 2 3) #(x 2 3))`},
+	} {
+		res, err := interp.EvalString(ctx, test.code)
+		assert.NoError(t, err, test.code)
+		assert.Equal(t, test.expected, toStr(res), test.code)
+	}
+
+	for _, code := range []string{`(vector-ref v 3)`, `(vector-copy v 2 1)`} {
+		_, err := interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(ExecError), code)
+	}
+	for _, code := range []string{`(vector-ref '(1) 0)`, `(vector-ref v 1.5)`} {
+		_, err := interp.EvalString(ctx, code)
+		assert.ErrorAs(t, err, new(TypeError), code)
+	}
+
+	s, err := ToGo[[]int](NewArray(Integer(1), Integer(2)))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, s)
+}